@@ -1,5 +1,11 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type PowerHint int32
 const (
 	//Android Open Source Project
@@ -23,6 +29,46 @@ const (
 	HINT_LINEAGE_SET_PROFILE PowerHint = 0x00000111
 )
 
+var powerHintNames = map[PowerHint]string{
+	HINT_VSYNC: "VSYNC",
+	HINT_INTERACTION: "INTERACTION",
+	HINT_VIDEO_ENCODE: "VIDEO_ENCODE",
+	HINT_VIDEO_DECODE: "VIDEO_DECODE",
+	HINT_LOW_POWER: "LOW_POWER",
+	HINT_SUSTAINED_PERFORMANCE: "SUSTAINED_PERFORMANCE",
+	HINT_VR_MODE: "VR_MODE",
+	HINT_LAUNCH: "LAUNCH",
+	HINT_AUDIO_STREAMING: "AUDIO_STREAMING",
+	HINT_AUDIO_LOW_LATENCY: "AUDIO_LOW_LATENCY",
+	HINT_CAMERA_LAUNCH: "CAMERA_LAUNCH",
+	HINT_CAMERA_STREAMING: "CAMERA_STREAMING",
+	HINT_CAMERA_SHOT: "CAMERA_SHOT",
+	HINT_EXPENSIVE_RENDERING: "EXPENSIVE_RENDERING",
+	HINT_LINEAGE_CPU_BOOST: "LINEAGE_CPU_BOOST",
+	HINT_LINEAGE_SET_PROFILE: "LINEAGE_SET_PROFILE",
+}
+
+func (hint PowerHint) String() string {
+	if name, exists := powerHintNames[hint]; exists {
+		return name
+	}
+	return fmt.Sprintf("0x%08X", int32(hint))
+}
+
+//Accepts "LAUNCH", "HINT_LAUNCH", "launch" or the raw hint id in decimal or hex
+func ParsePowerHint(name string) (PowerHint, error) {
+	if id, err := strconv.ParseInt(name, 0, 32); err == nil {
+		return PowerHint(id), nil
+	}
+	name = strings.TrimPrefix(strings.ToUpper(name), "HINT_")
+	for hint, hintName := range powerHintNames {
+		if hintName == name {
+			return hint, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown power hint %s", name)
+}
+
 type PowerFeature int32
 const (
 	//Android Open Source Project
@@ -30,4 +76,112 @@ const (
 
 	//LineageOS
 	FEATURE_SUPPORTED_PROFILES PowerFeature = 0x00001000
-)
\ No newline at end of file
+)
+
+//AIDL IPower (android.hardware.power.Mode)
+type PowerMode int32
+const (
+	MODE_DOUBLE_TAP_TO_WAKE PowerMode = iota
+	MODE_LOW_POWER
+	MODE_SUSTAINED_PERFORMANCE
+	MODE_FIXED_PERFORMANCE
+	MODE_VR
+	MODE_LAUNCH
+	MODE_EXPENSIVE_RENDERING
+	MODE_INTERACTIVE
+	MODE_DEVICE_IDLE
+	MODE_DISPLAY_INACTIVE
+	MODE_AUDIO_STREAMING_LOW_LATENCY
+	MODE_CAMERA_STREAMING_SECURE
+	MODE_CAMERA_STREAMING_LOW
+	MODE_CAMERA_STREAMING_MID
+	MODE_CAMERA_STREAMING_HIGH
+	MODE_GAME
+	MODE_GAME_LOADING
+	MODE_DISPLAY_CHANGE
+	MODE_AUTOMOTIVE_PROJECTION
+)
+
+var powerModeNames = map[PowerMode]string{
+	MODE_DOUBLE_TAP_TO_WAKE: "DOUBLE_TAP_TO_WAKE",
+	MODE_LOW_POWER: "LOW_POWER",
+	MODE_SUSTAINED_PERFORMANCE: "SUSTAINED_PERFORMANCE",
+	MODE_FIXED_PERFORMANCE: "FIXED_PERFORMANCE",
+	MODE_VR: "VR",
+	MODE_LAUNCH: "LAUNCH",
+	MODE_EXPENSIVE_RENDERING: "EXPENSIVE_RENDERING",
+	MODE_INTERACTIVE: "INTERACTIVE",
+	MODE_DEVICE_IDLE: "DEVICE_IDLE",
+	MODE_DISPLAY_INACTIVE: "DISPLAY_INACTIVE",
+	MODE_AUDIO_STREAMING_LOW_LATENCY: "AUDIO_STREAMING_LOW_LATENCY",
+	MODE_CAMERA_STREAMING_SECURE: "CAMERA_STREAMING_SECURE",
+	MODE_CAMERA_STREAMING_LOW: "CAMERA_STREAMING_LOW",
+	MODE_CAMERA_STREAMING_MID: "CAMERA_STREAMING_MID",
+	MODE_CAMERA_STREAMING_HIGH: "CAMERA_STREAMING_HIGH",
+	MODE_GAME: "GAME",
+	MODE_GAME_LOADING: "GAME_LOADING",
+	MODE_DISPLAY_CHANGE: "DISPLAY_CHANGE",
+	MODE_AUTOMOTIVE_PROJECTION: "AUTOMOTIVE_PROJECTION",
+}
+
+func (mode PowerMode) String() string {
+	if name, exists := powerModeNames[mode]; exists {
+		return name
+	}
+	return fmt.Sprintf("%d", int32(mode))
+}
+
+//Accepts "GAME", "MODE_GAME", "game" or the raw mode id
+func ParsePowerMode(name string) (PowerMode, error) {
+	if id, err := strconv.ParseInt(name, 0, 32); err == nil {
+		return PowerMode(id), nil
+	}
+	name = strings.TrimPrefix(strings.ToUpper(name), "MODE_")
+	for mode, modeName := range powerModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown power mode %s", name)
+}
+
+//AIDL IPower (android.hardware.power.Boost)
+type PowerBoost int32
+const (
+	BOOST_INTERACTION PowerBoost = iota
+	BOOST_DISPLAY_UPDATE_IMMINENT
+	BOOST_ML_ACC
+	BOOST_AUDIO_LAUNCH
+	BOOST_CAMERA_LAUNCH
+	BOOST_CAMERA_SHOT
+)
+
+var powerBoostNames = map[PowerBoost]string{
+	BOOST_INTERACTION: "INTERACTION",
+	BOOST_DISPLAY_UPDATE_IMMINENT: "DISPLAY_UPDATE_IMMINENT",
+	BOOST_ML_ACC: "ML_ACC",
+	BOOST_AUDIO_LAUNCH: "AUDIO_LAUNCH",
+	BOOST_CAMERA_LAUNCH: "CAMERA_LAUNCH",
+	BOOST_CAMERA_SHOT: "CAMERA_SHOT",
+}
+
+func (boost PowerBoost) String() string {
+	if name, exists := powerBoostNames[boost]; exists {
+		return name
+	}
+	return fmt.Sprintf("%d", int32(boost))
+}
+
+//Accepts "INTERACTION", "BOOST_INTERACTION", "interaction" or the raw boost id
+func ParsePowerBoost(name string) (PowerBoost, error) {
+	if id, err := strconv.ParseInt(name, 0, 32); err == nil {
+		return PowerBoost(id), nil
+	}
+	name = strings.TrimPrefix(strings.ToUpper(name), "BOOST_")
+	for boost, boostName := range powerBoostNames {
+		if boostName == name {
+			return boost, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown power boost %s", name)
+}
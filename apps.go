@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	APPS_INTERVAL_DEFAULT = 1000 //Milliseconds between foreground checks
+	CPUSET_TOP_APP        = "top-app"
+)
+
+var procPath = "/proc"
+
+var (
+	appsMutex        sync.Mutex
+	appActive        string //Name of the foreground app whose profile is layered on top
+	appActiveProfile string
+)
+
+func (dev *Device) initApps() error {
+	if dev.AppsInterval.String() != "" {
+		if interval, err := dev.AppsInterval.Int64(); err != nil || interval <= 0 {
+			return fmt.Errorf("apps_interval: invalid interval %s", dev.AppsInterval)
+		}
+	}
+	for app, profile := range dev.Apps {
+		if _, err := filepath.Match(app, ""); err != nil {
+			return fmt.Errorf("apps/%s: invalid pattern: %v", app, err)
+		}
+		profile = strings.ReplaceAll(strings.ToLower(profile), " ", "_")
+		if !dev.HasProfile(profile) {
+			return fmt.Errorf("apps/%s: %w: %s", app, ErrNoProfile, profile)
+		}
+		dev.Apps[app] = profile
+		Debug("Found app %s: %s", app, profile)
+	}
+	if len(dev.Apps) > 0 && dev.topAppTasks() == "" {
+		return fmt.Errorf("apps: no tasks path for the %s cpuset", CPUSET_TOP_APP)
+	}
+	return nil
+}
+
+func (dev *Device) topAppTasks() string {
+	if dev.Paths.Cpusets == nil {
+		return ""
+	}
+	set, exists := dev.Paths.Cpusets.Sets[CPUSET_TOP_APP]
+	if !exists || set.Tasks == "" {
+		return ""
+	}
+	return pathJoin(dev.Paths.Cpusets.Path, CPUSET_TOP_APP, set.Tasks)
+}
+
+//Returns the process names of every task in the top-app cpuset, sorted and without duplicates
+func foregroundApps(tasksPath string) ([]string, error) {
+	buffer, err := ioutil.ReadFile(tasksPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	apps := make([]string, 0)
+	for _, task := range strings.Fields(string(buffer)) {
+		if _, err := strconv.Atoi(task); err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(pathJoin(procPath, task, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue //Exited, or a kernel thread
+		}
+		name := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		apps = append(apps, name)
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+//Returns the first foreground app with a profile, preferring exact names over patterns
+//Processes such as "com.example:remote" also match the package they belong to
+func (dev *Device) appProfile(apps []string) (string, string) {
+	patterns := make([]string, 0, len(dev.Apps))
+	for pattern := range dev.Apps {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	candidates := func(app string) []string {
+		if i := strings.Index(app, ":"); i > 0 {
+			return []string{app, app[:i]}
+		}
+		return []string{app}
+	}
+	for _, app := range apps {
+		for _, name := range candidates(app) {
+			if profile, exists := dev.Apps[name]; exists {
+				return app, profile
+			}
+		}
+	}
+	for _, app := range apps {
+		for _, name := range candidates(app) {
+			for _, pattern := range patterns {
+				if match, _ := filepath.Match(pattern, name); match {
+					return app, dev.Apps[pattern]
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+//Follows the foreground app until the daemon exits, picking up reloaded manifests as it goes
+func runApps() {
+	for {
+		interval := int64(APPS_INTERVAL_DEFAULT)
+		if dev := currentDevice(); dev != nil {
+			if dev.AppsInterval.String() != "" {
+				interval, _ = dev.AppsInterval.Int64()
+			}
+			if len(dev.Apps) > 0 {
+				evaluateApps(dev)
+			}
+		}
+		time.Sleep(time.Millisecond * time.Duration(interval))
+	}
+}
+
+func evaluateApps(dev *Device) {
+	appsMutex.Lock()
+	defer appsMutex.Unlock()
+
+	apps, err := foregroundApps(dev.topAppTasks())
+	if err != nil {
+		Debug("Failed to read foreground apps: %v", err)
+		return
+	}
+	app, profile := dev.appProfile(apps)
+
+	if app == appActive && profile == appActiveProfile {
+		return
+	}
+
+	if currentDevice() != dev {
+		return //Reloaded while reading the foreground, the next check uses the new apps
+	}
+
+	//The app's profile is an overlay, so the user's own choice is never replaced or cached
+	//Switching apps swaps the overlay in one apply, so the base profile isn't written in between
+	old := ""
+	if appActive != "" {
+		Info("App %s left the foreground", appActive)
+		publish(Event{Type: EventApp, Source: "app:" + appActive, Profile: appActiveProfile, Detail: "off"})
+		old = "app:" + appActive
+	}
+	var overlay *Overlay
+	if app != "" {
+		Info("App %s is in the foreground, switching to %s", app, profile)
+		publish(Event{Type: EventApp, Source: "app:" + app, Profile: profile, Detail: "on"})
+		overlay = &Overlay{Source: "app:" + app, Profile: profile, Priority: defaultPriority(profile), Replace: true}
+	}
+	if err := replaceOverlay(old, overlay); err != nil && !errors.Is(err, ErrLocked) {
+		Warn("Failed to apply the profile for app %s: %v", app, err)
+	}
+	appActive, appActiveProfile = app, profile
+}
+
+//Returns the foreground app that's currently in control, if any
+func activeApp() string {
+	appsMutex.Lock()
+	defer appsMutex.Unlock()
+	return appActive
+}
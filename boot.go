@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BOOT_SETTLE_SENSOR_DEFAULT   = SENSOR_LOADAVG
+	BOOT_SETTLE_WINDOW_DEFAULT   = 10   //Seconds the sensor has to stay below the threshold
+	BOOT_SETTLE_INTERVAL_DEFAULT = 1000 //Milliseconds between settle checks
+)
+
+//Ends the boot profile as soon as the sensor stays below the threshold for the window
+//Pressure, such as "psi.cpu", reacts within seconds, while the 1 minute load average trails the actual load
+type BootSettle struct {
+	Sensor   string
+	Below    json.Number
+	Window   json.Number //Seconds
+	Interval json.Number //Milliseconds
+	below    float64
+	window   time.Duration
+	interval time.Duration
+}
+
+var (
+	bootLease *time.Timer //Ends the boot lease once the boot profile duration is up, protected by lock
+	bootLeaseEnd time.Time
+	bootSettleStop chan bool //Closed when the boot lease ends, stopping the settle watch
+	bootReleased chan bool   //Closed when the boot lease ends and the deferred profile was applied
+)
+
+func (dev *Device) initBootSettle() error {
+	settle := dev.ProfileBootSettle
+	if settle == nil {
+		return nil
+	}
+	if duration, err := dev.ProfileBootDuration.Int64(); err != nil || duration <= 0 {
+		return fmt.Errorf("profile_boot_settle: needs profile_boot_duration as the upper bound")
+	}
+	if settle.Sensor == "" {
+		settle.Sensor = BOOT_SETTLE_SENSOR_DEFAULT
+	}
+	settle.Sensor = strings.ToLower(settle.Sensor)
+	if err := dev.validSensor(settle.Sensor); err != nil {
+		return fmt.Errorf("profile_boot_settle: %v", err)
+	}
+	below, err := settle.Below.Float64()
+	if err != nil {
+		return fmt.Errorf("profile_boot_settle: invalid threshold %s", settle.Below)
+	}
+	settle.below = below
+	settle.window = time.Second * BOOT_SETTLE_WINDOW_DEFAULT
+	if settle.Window.String() != "" {
+		window, err := settle.Window.Int64()
+		if err != nil || window <= 0 {
+			return fmt.Errorf("profile_boot_settle: invalid window %s", settle.Window)
+		}
+		settle.window = time.Second * time.Duration(window)
+	}
+	settle.interval = time.Millisecond * BOOT_SETTLE_INTERVAL_DEFAULT
+	if settle.Interval.String() != "" {
+		interval, err := settle.Interval.Int64()
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("profile_boot_settle: invalid interval %s", settle.Interval)
+		}
+		settle.interval = time.Millisecond * time.Duration(interval)
+	}
+	Debug("Releasing boot profile once %s stays below %g for %s", settle.Sensor, settle.below, settle.window)
+	return nil
+}
+
+//Holds the boot profile for duration, while every request that comes in meanwhile is recorded and applied once the lease ends
+//Must be called with lock held
+func startBootLease(duration time.Duration) {
+	device.ProfileLock = true
+	bootLocked = true
+	bootLeaseEnd = time.Now().Add(duration)
+	bootReleased = make(chan bool)
+	bootLease = time.AfterFunc(duration, func() {
+		releaseBoot("boot")
+	})
+	if device.ProfileBootSettle != nil {
+		bootSettleStop = make(chan bool)
+		go watchBootSettle(device, device.ProfileBootSettle, bootSettleStop)
+	}
+}
+
+//Releases the boot profile once the settle sensor stays below its threshold for the whole window
+func watchBootSettle(dev *Device, settle *BootSettle, stop chan bool) {
+	ticker := time.NewTicker(settle.interval)
+	defer ticker.Stop()
+	var since time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		value, err := dev.readSensor(settle.Sensor, nil)
+		if err == nil {
+			var reading float64
+			if reading, err = strconv.ParseFloat(value, 64); err == nil {
+				if reading >= settle.below {
+					since = time.Time{}
+					continue
+				}
+				if since.IsZero() {
+					Debug("Boot settling, %s at %g", settle.Sensor, reading)
+					since = time.Now()
+				}
+				if time.Since(since) >= settle.window {
+					Info("Boot settled, %s stayed below %g for %s", settle.Sensor, settle.below, settle.window)
+					releaseBoot("settle")
+					return
+				}
+				continue
+			}
+		}
+		//Don't keep failing every interval, the boot duration still ends the lease
+		Warn("Not watching %s for the boot to settle: %v", settle.Sensor, err)
+		return
+	}
+}
+
+//export PowerPulse_ReleaseBoot
+func PowerPulse_ReleaseBoot() {
+	go releaseBoot("hal")
+}
+//export PowerPulse_ReleaseBootSync
+func PowerPulse_ReleaseBootSync() int32 {
+	return setStatus(releaseBoot("hal"))
+}
+//Ends the boot lease, early if it's still running, and applies the profile that was deferred
+func releaseBoot(source string) error {
+	if err := initialize(); err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !bootLocked {
+		return nil
+	}
+	if bootLease != nil {
+		bootLease.Stop()
+		bootLease = nil
+	}
+	if bootSettleStop != nil {
+		close(bootSettleStop)
+		bootSettleStop = nil
+	}
+	if remaining := time.Until(bootLeaseEnd); remaining > 0 {
+		Info("Releasing boot profile %s %s early", device.ProfileBoot, remaining.Round(time.Second))
+	} else {
+		Info("Releasing boot profile %s", device.ProfileBoot)
+	}
+	bootLocked = false
+	device.ProfileLock = false
+	publish(Event{Type: EventBootReleased, Source: source, Profile: device.ProfileBoot})
+	err := applyOverlays(source)
+	close(bootReleased)
+	bootReleased = nil
+	return err
+}
+
+//Blocks until the boot lease ends, returning right away if there isn't one
+func waitBootReleased() {
+	lock.Lock()
+	released := bootReleased
+	lock.Unlock()
+	if released != nil {
+		Info("Waiting for boot profile %s to be released", device.ProfileBoot)
+		<-released
+	}
+}
+
+//Returns how long the boot lease has left, or 0 once it's released
+func bootLeaseRemaining() time.Duration {
+	if !bootLocked {
+		return 0
+	}
+	if remaining := time.Until(bootLeaseEnd); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
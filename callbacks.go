@@ -0,0 +1,91 @@
+package main
+
+// /* Events delivered to a PowerPulseCallback */
+// typedef enum {
+// 	PP_EVENT_PROFILE_APPLIED = 1,
+// 	PP_EVENT_APPLY_FAILED = 2,
+// 	PP_EVENT_BOOT_RELEASED = 3,
+// 	PP_EVENT_CONFIG_RELOADED = 4,
+// 	PP_EVENT_BOOST = 5,
+// 	PP_EVENT_INTERACTIVE = 6,
+// 	PP_EVENT_RULE = 7,
+// 	PP_EVENT_THROTTLE = 8,
+// 	PP_EVENT_APP = 9,
+// } PowerPulseEvent;
+//
+// /* profile, detail and error may be NULL, and are only valid for the duration of the call */
+// typedef void (*PowerPulseCallback)(PowerPulseEvent event, const char *profile, const char *detail, const char *error, void *userdata);
+//
+// static inline void powerpulse_invoke(PowerPulseCallback cb, PowerPulseEvent event, const char *profile, const char *detail, const char *error, void *userdata) {
+// 	cb(event, profile, detail, error, userdata);
+// }
+//
+// #include <stdlib.h>
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+var (
+	callbackMutex  sync.Mutex
+	callbackEvents chan Event
+)
+
+var callbackCodes = map[EventType]C.PowerPulseEvent{
+	EventProfileApplied: C.PP_EVENT_PROFILE_APPLIED,
+	EventApplyFailed: C.PP_EVENT_APPLY_FAILED,
+	EventBootReleased: C.PP_EVENT_BOOT_RELEASED,
+	EventConfigReloaded: C.PP_EVENT_CONFIG_RELOADED,
+	EventBoost: C.PP_EVENT_BOOST,
+	EventInteractive: C.PP_EVENT_INTERACTIVE,
+	EventRule: C.PP_EVENT_RULE,
+	EventThrottle: C.PP_EVENT_THROTTLE,
+	EventApp: C.PP_EVENT_APP,
+}
+
+//Replaces any registered callback, or unregisters it when cb is NULL
+//The callback runs on a PowerPulse thread and must not block, nor call back into PowerPulse synchronously
+//export PowerPulse_RegisterCallback
+func PowerPulse_RegisterCallback(cb C.PowerPulseCallback, userdata unsafe.Pointer) {
+	callbackMutex.Lock()
+	defer callbackMutex.Unlock()
+
+	if callbackEvents != nil {
+		unsubscribe(callbackEvents)
+		callbackEvents = nil
+	}
+	if cb == nil {
+		Debug("Unregistered event callback")
+		return
+	}
+
+	callbackEvents = subscribe()
+	go invokeCallback(callbackEvents, cb, userdata)
+	Debug("Registered event callback")
+}
+
+//Runs until the subscription is replaced or removed
+func invokeCallback(events chan Event, cb C.PowerPulseCallback, userdata unsafe.Pointer) {
+	for event := range events {
+		code, exists := callbackCodes[event.Type]
+		if !exists {
+			continue
+		}
+		profile := cStringOrNil(event.Profile)
+		detail := cStringOrNil(event.Detail)
+		errStr := cStringOrNil(event.Error)
+		C.powerpulse_invoke(cb, code, profile, detail, errStr, userdata)
+		C.free(unsafe.Pointer(profile))
+		C.free(unsafe.Pointer(detail))
+		C.free(unsafe.Pointer(errStr))
+	}
+}
+
+func cStringOrNil(str string) *C.char {
+	if str == "" {
+		return nil
+	}
+	return C.CString(str)
+}
@@ -6,15 +6,17 @@ import (
 )
 
 //boostpulse_duration takes microseconds as input, so do we
-func (dev *Device) Boost(durMs int32) {
+//Returns whether any cluster was boosted
+func (dev *Device) Boost(durMs int32) bool {
 	//Snapshot the time so we don't prolong or delay boosts
 	startTime := time.Now()
 	dev.BoostMutex.Lock()
 	defer dev.BoostMutex.Unlock()
 
 	profile := dev.GetProfileNow()
-	if profile == nil { return }
+	if profile == nil { return false }
 
+	boosted := false
 	for clusterName := range profile.Clusters {
 		clusterDurMs := durMs
 		if durMs <= 0 {
@@ -39,8 +41,29 @@ func (dev *Device) Boost(durMs int32) {
 				continue
 			}
 			go Debug("Boosting %s for %dμs", clusterName, clusterDurMs)
+			boosted = true
 		} else { Error("Failed to boost %s: Could not identify governor", clusterName) }
 	}
+	return boosted
+}
+
+//Returns whether the governor of any cluster in the applied profile can boostpulse
+func (dev *Device) CanBoost() bool {
+	profile := dev.GetProfileNow()
+	if profile == nil {
+		return false
+	}
+	for clusterName := range profile.Clusters {
+		governorName := dev.GetCPUGovernor(clusterName)
+		pathCluster, exists := dev.Paths.Clusters[clusterName]
+		if governorName == "" || !exists || pathCluster.CPUFreq == nil {
+			continue
+		}
+		if pathValid(pathJoin(pathCluster.Path, pathCluster.CPUFreq.Path, governorName, "boostpulse")) {
+			return true
+		}
+	}
+	return false
 }
 
 func (dev *Device) GovernCPU(clusterName string) {
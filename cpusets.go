@@ -19,7 +19,7 @@ func (dev *Device) setCpusets(profile *Profile) error {
 			exclusivePath := pathJoin(setPath, dev.Paths.Cpusets.Sets[setName].CPUExclusive)
 			if err := dev.BufferWriteBool(exclusivePath, false); err != nil {return err}
 		}
-		dev.SyncProfile()
+		if err := dev.SyncProfile(); err != nil {return err}
 
 		//Set up the new CPU sets
 		for setName, set := range sets {
@@ -31,7 +31,7 @@ func (dev *Device) setCpusets(profile *Profile) error {
 			cpusPath := pathJoin(setPath, dev.Paths.Cpusets.Sets[setName].CPUs)
 			dev.BufferWrite(cpusPath, set.CPUs)
 		}
-		dev.SyncProfile()
+		if err := dev.SyncProfile(); err != nil {return err}
 
 		//Finally, set up any new CPU exclusives
 		for setName, set := range sets {
@@ -45,7 +45,7 @@ func (dev *Device) setCpusets(profile *Profile) error {
 				if err := dev.BufferWriteBool(exclusivePath, *set.CPUExclusive); err != nil {return err}
 			}
 		}
-		dev.SyncProfile()
+		if err := dev.SyncProfile(); err != nil {return err}
 	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const ctlUsage = `usage: powerpulsectl [-s socket] <command> [args]
+
+commands:
+  status                  show the daemon's profile state and discovered subsystems
+  list                    list the profiles in the manifest
+  set <profile>           apply a profile
+  reset                   return to the previous profile
+  release                 end the boot profile early and apply the profile it deferred
+  hint <hint> [data]      send a power hint, by name (LAUNCH) or id (0x8)
+  mode <mode> <on|off>    toggle an AIDL power mode, by name (GAME) or id
+  boost <boost> [ms]      send an AIDL power boost, by name (INTERACTION) or id
+  interactive <on|off>    toggle the screen state
+  reload                  reload the manifest and reapply the current profile
+  subscribe [types...]    print events as they happen, optionally only of the given types:
+                          profile_applied apply_failed boot_released boost
+                          config_reloaded interactive rule throttle app
+`
+
+//Runs a client command against the daemon and returns the exit code
+func ctl(args []string) int {
+	//Parsed here too, as "powerpulse ctl -s socket" passes everything after ctl through
+	flags := pflag.NewFlagSet("powerpulsectl", pflag.ContinueOnError)
+	flags.StringVarP(&socketPath, "socket", "s", socketPath, "path to the control socket")
+	flags.SetInterspersed(false)
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			fmt.Print(ctlUsage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "powerpulsectl: %v\n", err)
+		fmt.Fprint(os.Stderr, ctlUsage)
+		return 2
+	}
+	args = flags.Args()
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, ctlUsage)
+		return 2
+	}
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Print(ctlUsage)
+		return 0
+	}
+
+	if args[0] == "subscribe" {
+		return ctlSubscribe(args[1:])
+	}
+
+	result, err := ctlRequest(DaemonRequest{Command: args[0], Args: args[1:]})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "powerpulsectl: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "status":
+		status := &DaemonStatus{}
+		if err := json.Unmarshal(result, status); err != nil {
+			fmt.Fprintf(os.Stderr, "powerpulsectl: invalid status: %v\n", err)
+			return 1
+		}
+		ctlPrintStatus(status)
+	case "list":
+		profiles := &DaemonProfiles{}
+		if err := json.Unmarshal(result, profiles); err != nil {
+			fmt.Fprintf(os.Stderr, "powerpulsectl: invalid profile list: %v\n", err)
+			return 1
+		}
+		ctlPrintProfiles(profiles)
+	default:
+		if len(result) > 0 && string(result) != "null" {
+			fmt.Println(string(result))
+		}
+	}
+	return 0
+}
+
+func ctlRequest(req DaemonRequest) (json.RawMessage, error) {
+	conn, _, result, err := ctlDial(req)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	return result, nil
+}
+
+//Sends a request and reads its response, leaving the connection open for anything that follows
+func ctlDial(req DaemonRequest) (net.Conn, *bufio.Reader, json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second * 5)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to reach daemon at %s: %v", socketPath, err)
+	}
+
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", reqJSON); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to send %s: %v", req.Command, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to read response to %s: %v", req.Command, err)
+	}
+	resp := struct {
+		OK     bool            `json:"ok"`
+		Error  string          `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("invalid response to %s: %v", req.Command, err)
+	}
+	if !resp.OK {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("%s", resp.Error)
+	}
+	return conn, reader, resp.Result, nil
+}
+
+func ctlSubscribe(types []string) int {
+	conn, reader, _, err := ctlDial(DaemonRequest{Command: "subscribe", Args: types})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "powerpulsectl: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "powerpulsectl: daemon went away: %v\n", err)
+			return 1
+		}
+		event := Event{}
+		if err := json.Unmarshal(line, &event); err != nil {
+			fmt.Fprintf(os.Stderr, "powerpulsectl: invalid event: %v\n", err)
+			continue
+		}
+		ctlPrintEvent(&event)
+	}
+}
+
+func ctlPrintStatus(status *DaemonStatus) {
+	if !status.Ready {
+		fmt.Println("Ready:         no (check the manifest and reload)")
+	}
+	fmt.Printf("Profile:       %s\n", status.Profile)
+	fmt.Printf("Last profile:  %s\n", status.ProfileLast)
+	applied := status.Applied
+	for _, overlay := range status.AppliedOverlays {
+		applied += " + " + overlay
+	}
+	if status.Throttled {
+		applied += " (thermal caps)"
+	}
+	fmt.Printf("Applied:       %s\n", applied)
+	fmt.Printf("Profile order: %s\n", strings.Join(status.ProfileOrder, " "))
+	fmt.Printf("Inheritance:   %s\n", strings.Join(status.ProfileInheritance, " "))
+	if len(status.Lineage) > 0 {
+		ids := make([]int, 0, len(status.Lineage))
+		for id := range status.Lineage {
+			if n, err := strconv.Atoi(id); err == nil {
+				ids = append(ids, n)
+			}
+		}
+		sort.Ints(ids)
+		lineage := make([]string, 0, len(ids))
+		for _, id := range ids {
+			lineage = append(lineage, fmt.Sprintf("%d=%s", id, status.Lineage[strconv.Itoa(id)]))
+		}
+		fmt.Printf("Lineage:       %s\n", strings.Join(lineage, " "))
+	}
+	if status.App != "" {
+		fmt.Printf("App:           %s\n", status.App)
+	}
+	if status.Rule != "" {
+		fmt.Printf("Rule:          %s\n", status.Rule)
+	}
+	if len(status.Overlays) > 0 {
+		layers := make([]string, 0, len(status.Overlays))
+		for _, overlay := range status.Overlays {
+			layer := fmt.Sprintf("%s@%d (%s)", overlay.Profile, overlay.Priority, overlay.Source)
+			if !overlay.Replace {
+				layer = "+" + layer
+			}
+			layers = append(layers, layer)
+		}
+		fmt.Printf("Overlays:      %s\n", strings.Join(layers, " "))
+	}
+	if len(status.Throttle) > 0 {
+		names := make([]string, 0, len(status.Throttle))
+		for name := range status.Throttle {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		steps := make([]string, 0, len(names))
+		for _, name := range names {
+			steps = append(steps, fmt.Sprintf("%s step %d", name, status.Throttle[name]))
+		}
+		fmt.Printf("Throttle:      %s\n", strings.Join(steps, ", "))
+	}
+	if len(status.Sensors) > 0 {
+		names := make([]string, 0, len(status.Sensors))
+		for name := range status.Sensors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println("Sensors:")
+		for _, name := range names {
+			fmt.Printf("  %-20s %s\n", name, status.Sensors[name])
+		}
+	}
+	if status.BootLock {
+		fmt.Printf("Boot lock:     active (%ds left)\n", status.BootLockRemaining)
+	} else {
+		fmt.Println("Boot lock:     released")
+	}
+	fmt.Printf("Subsystems:    %s\n", strings.Join(status.Subsystems, " "))
+}
+
+func ctlPrintEvent(event *Event) {
+	msg := fmt.Sprintf("%s %s", event.Time.Format("2006-01-02 15:04:05.000"), event.Type)
+	if event.Profile != "" {
+		msg += " " + event.Profile
+	}
+	if event.Detail != "" {
+		msg += " " + event.Detail
+	}
+	msg += " (" + event.Source + ")"
+	if event.Error != "" {
+		msg += ": " + event.Error
+	}
+	fmt.Println(msg)
+}
+
+func ctlPrintProfiles(profiles *DaemonProfiles) {
+	printed := make(map[string]bool)
+	printProfile := func(name string) {
+		if printed[name] {
+			return
+		}
+		printed[name] = true
+		if name == profiles.Active {
+			fmt.Printf("* %s\n", name)
+		} else {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	//Selectable profiles first, in the order they're stargazed
+	for _, name := range profiles.Order {
+		printProfile(name)
+	}
+	for _, name := range profiles.Profiles {
+		printProfile(name)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	daemonMode = false
+	socketPath = "/dev/powerpulse.sock"
+)
+
+//Commands can be sent as plain lines ("set performance") or as JSON objects ({"command":"set","args":["performance"]})
+type DaemonRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type DaemonResponse struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+type DaemonStatus struct {
+	Ready              bool     `json:"ready"`
+	Profile            string   `json:"profile"`             //The profile the user or framework asked for
+	ProfileLast        string   `json:"profile_last"`        //The profile a reset will return to
+	Applied            string   `json:"applied"`             //The profile currently applied to the device
+	AppliedOverlays    []string `json:"applied_overlays,omitempty"` //Overlay profiles applied on top of it, in order
+	Throttled          bool     `json:"throttled,omitempty"`  //Whether thermal caps are applied on top of it
+	ProfileOrder       []string `json:"profile_order"`
+	ProfileInheritance []string `json:"profile_inheritance"`
+	Lineage            map[string]string `json:"lineage,omitempty"` //Profiles per LineageOS profile id
+	BootLock           bool     `json:"boot_lock"`           //Whether the boot profile is still holding off other profiles
+	BootLockRemaining  int64    `json:"boot_lock_remaining,omitempty"` //Seconds left until the boot profile is released
+	Rule               string   `json:"rule,omitempty"`      //The rule that last switched profiles, while it still applies
+	App                string   `json:"app,omitempty"`       //The foreground app that last switched profiles, while it's still in front
+	Overlays           []Overlay `json:"overlays,omitempty"` //Active overlays from lowest to highest priority
+	Throttle           map[string]int `json:"throttle,omitempty"` //Active step of each throttle, counting from 1
+	Sensors            map[string]string `json:"sensors,omitempty"` //Current value of every sensor the manifest uses
+	Subsystems         []string `json:"subsystems"`          //Subsystems discovered by Paths.Init
+}
+
+type DaemonProfiles struct {
+	Active   string   `json:"active"`
+	Order    []string `json:"order"`
+	Profiles []string `json:"profiles"`
+}
+
+func daemon() error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %s: %v", socketPath, err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0660); err != nil {
+		Warn("Failed to restrict permissions on %s: %v", socketPath, err)
+	}
+
+	//Clean up the socket when we're asked to leave
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		Info("Caught %s, closing %s", sig, socketPath)
+		listener.Close()
+	}()
+
+	Info("Listening for commands on %s", socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				os.Remove(socketPath)
+				return nil
+			}
+			Warn("Failed to accept connection: %v", err)
+			continue
+		}
+		go daemonConn(conn)
+	}
+}
+
+func daemonConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		//JSON framing gets a JSON response, line framing gets a line response
+		if line[0] == '{' {
+			req := DaemonRequest{}
+			resp := DaemonResponse{}
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				resp.Error = fmt.Sprintf("invalid request: %v", err)
+			} else if strings.ToLower(req.Command) == "subscribe" {
+				daemonSubscribe(conn, req.Args, true)
+				return
+			} else {
+				resp.Result, err = dispatch(req)
+				if err != nil {
+					resp.Error = err.Error()
+				} else {
+					resp.OK = true
+				}
+			}
+			respJSON, err := json.Marshal(resp)
+			if err != nil {
+				Error("Failed to marshal response to %s: %v", req.Command, err)
+				return
+			}
+			if _, err := fmt.Fprintf(conn, "%s\n", respJSON); err != nil {
+				return
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if strings.ToLower(fields[0]) == "subscribe" {
+			daemonSubscribe(conn, fields[1:], false)
+			return
+		}
+		result, err := dispatch(DaemonRequest{Command: fields[0], Args: fields[1:]})
+		if err != nil {
+			if _, err := fmt.Fprintf(conn, "ERR %v\n", err); err != nil {
+				return
+			}
+			continue
+		}
+		switch v := result.(type) {
+		case nil:
+			_, err = fmt.Fprintf(conn, "OK\n")
+		case string:
+			_, err = fmt.Fprintf(conn, "OK %s\n", v)
+		default:
+			resultJSON, jsonErr := json.Marshal(v)
+			if jsonErr != nil {
+				_, err = fmt.Fprintf(conn, "ERR %v\n", jsonErr)
+			} else {
+				_, err = fmt.Fprintf(conn, "OK %s\n", resultJSON)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+//Streams events to the client until it hangs up, optionally only those of the given types
+func daemonSubscribe(conn net.Conn, types []string, framed bool) {
+	filter := make(map[EventType]bool)
+	for _, eventType := range types {
+		filter[EventType(strings.ToLower(eventType))] = true
+	}
+
+	events := subscribe()
+	defer unsubscribe(events)
+
+	ack := "OK\n"
+	if framed {
+		ack = "{\"ok\":true}\n"
+	}
+	if _, err := fmt.Fprint(conn, ack); err != nil {
+		return
+	}
+	Debug("Daemon: subscribed to %s", types)
+
+	//The client has nothing more to say, so any read means it's gone
+	hangup := make(chan bool)
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(hangup)
+	}()
+
+	for {
+		select {
+		case <-hangup:
+			Debug("Daemon: unsubscribed from %s", types)
+			return
+		case event := <-events:
+			if len(filter) > 0 && !filter[event.Type] {
+				continue
+			}
+			eventJSON, err := json.Marshal(event)
+			if err != nil {
+				Error("Failed to marshal %s event: %v", event.Type, err)
+				continue
+			}
+			if framed {
+				_, err = fmt.Fprintf(conn, "%s\n", eventJSON)
+			} else {
+				_, err = fmt.Fprintf(conn, "EVENT %s\n", eventJSON)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func dispatch(req DaemonRequest) (interface{}, error) {
+	command := strings.ToLower(req.Command)
+	Debug("Daemon: %s %s", command, req.Args)
+
+	switch command {
+	case "status":
+		return getStatus(), nil
+	case "reload":
+		if err := reloadConfig("socket"); err != nil {
+			return nil, err
+		}
+		if profile := requestedProfile(); profile != "" {
+			return nil, setProfile(profile, "reload")
+		}
+		return nil, nil
+	}
+
+	if err := initialize(); err != nil {
+		return nil, err
+	}
+
+	switch command {
+	case "list":
+		return getProfiles(), nil
+
+	case "set", "profile":
+		if len(req.Args) != 1 {
+			return nil, fmt.Errorf("usage: set <profile>")
+		}
+		profile := strings.ReplaceAll(strings.ToLower(req.Args[0]), " ", "_")
+		return nil, setProfile(profile, "socket")
+
+	case "reset":
+		return nil, resetProfile("socket")
+
+	case "release":
+		return nil, releaseBoot("socket")
+
+	case "hint":
+		if len(req.Args) < 1 || len(req.Args) > 2 {
+			return nil, fmt.Errorf("usage: hint <hint> [data]")
+		}
+		hint, err := ParsePowerHint(req.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		data := int64(0)
+		if len(req.Args) == 2 {
+			data, err = strconv.ParseInt(req.Args[1], 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid data %s for hint %s", req.Args[1], hint)
+			}
+		}
+		return nil, setPowerHint(int32(hint), int32(data), "socket")
+
+	case "mode":
+		if len(req.Args) != 2 {
+			return nil, fmt.Errorf("usage: mode <mode> <on|off>")
+		}
+		mode, err := ParsePowerMode(req.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		enabled, err := parseBool(req.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return nil, setMode(int32(mode), enabled, "socket")
+
+	case "boost":
+		if len(req.Args) < 1 || len(req.Args) > 2 {
+			return nil, fmt.Errorf("usage: boost <boost> [duration ms]")
+		}
+		powerBoost, err := ParsePowerBoost(req.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		durationMs := int64(0)
+		if len(req.Args) == 2 {
+			durationMs, err = strconv.ParseInt(req.Args[1], 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration %s for boost %s", req.Args[1], powerBoost)
+			}
+		}
+		return nil, setBoost(int32(powerBoost), int32(durationMs), "socket")
+
+	case "interactive":
+		if len(req.Args) != 1 {
+			return nil, fmt.Errorf("usage: interactive <on|off>")
+		}
+		interactive, err := parseBool(req.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		return nil, setInteractive(interactive, "socket")
+	}
+
+	return nil, fmt.Errorf("unknown command %s", req.Command)
+}
+
+func getStatus() *DaemonStatus {
+	//Snapshot everything lock protects first, then ask the watchers, which take lock themselves when they switch
+	lock.Lock()
+	dev := device
+	status := &DaemonStatus{
+		Ready: dev != nil,
+		Profile: profileNow,
+		ProfileLast: profileLast,
+	}
+	if dev != nil {
+		status.Applied = dev.Profile
+		status.AppliedOverlays = dev.ProfileOverlays
+		status.Throttled = dev.ProfileThrottled
+		status.BootLock = bootLocked
+		status.BootLockRemaining = int64(bootLeaseRemaining().Round(time.Second) / time.Second)
+		status.Overlays = activeOverlays()
+		status.Throttle = dev.throttleSteps()
+	}
+	lock.Unlock()
+
+	if dev != nil {
+		status.ProfileOrder = dev.ProfileOrder
+		status.ProfileInheritance = dev.ProfileInheritance
+		status.Lineage = dev.lineageTable()
+		status.Rule = activeRule()
+		status.App = activeApp()
+		status.Sensors = dev.readAllSensors()
+		if dev.Paths != nil {
+			status.Subsystems = dev.Paths.Subsystems()
+		}
+	}
+	return status
+}
+
+func getProfiles() *DaemonProfiles {
+	lock.Lock()
+	dev, active := device, profileNow
+	lock.Unlock()
+	profiles := &DaemonProfiles{
+		Active: active,
+		Order: dev.ProfileOrder,
+		Profiles: make([]string, 0, len(dev.Profiles)),
+	}
+	for profileName := range dev.Profiles {
+		profiles.Profiles = append(profiles.Profiles, profileName)
+	}
+	sort.Strings(profiles.Profiles)
+	return profiles
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "y", "enabled", "enable":
+		return true, nil
+	case "off", "no", "n", "disabled", "disable":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid bool %s", value)
+	}
+	return b, nil
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -12,15 +14,40 @@ type Device struct {
 	BoostMutex   sync.Mutex //Delays and prevents boosts based on time deltas
 	ProfileLock  bool       //Protects the live profile
 	ProfileMutex sync.Mutex //Prevents race conditions when toggling quickly between profiles
+	WriteCacheMutex sync.Mutex //Protects the write cache from governor and boost threads
 
 	Buffered            []BufferedWrite `json:"-"`                 //Buffered string values ready to be synced to each path
+	BufferedPairs       []BufferedPair `json:"-"`                  //Min and max paths that have to be written in a safe order
+	Journal             []BufferedWrite `json:"-"`                 //Values of each synced path before the running transaction, nil outside of one
+	DryRun              bool `json:"-"`                             //Plan buffered writes instead of syncing them, and never write to paths
+	WriteCache          map[string]cachedWrite `json:"-"`          //Last value written and read back per path, to skip unchanged writes
+	WriteCacheExclude   []string `json:"write_cache_exclude"`      //Path or base name patterns that are always written, on top of boostpulse
+	FreqDomains         map[string]*FrequencyDomain `json:"-"`     //Supported frequencies per cluster and GPU, read when first needed
+	Planned             []PlannedWrite `json:"-"`                  //Writes that would have been synced in dry run mode
+	PlanStep            int `json:"-"`                              //Number of syncs planned so far in dry run mode
+	Hints               map[string]*HintAction `json:"hints"`      //Actions to take for power hints and modes, replacing the defaults
 	Paths               *Paths                                     //Manifest of paths to device settings
 	ProfileBoot         string      `json:"profile_boot"`          //Default profile, used permanently without a profile manager
 	ProfileBootDuration json.Number `json:"profile_boot_duration"` //Force sets the boot profile for X seconds (no decimals) before setting the first requested profile after init
+	ProfileBootSettle   *BootSettle `json:"profile_boot_settle"`   //Releases the boot profile once the system settles, with profile_boot_duration as the upper bound
 	ProfileInheritance  []string    `json:"profile_inheritance"`   //Profile order for inheritance of configurations
 	ProfileOrder        []string    `json:"profile_order"`         //Profile order for stargazing
 	Profiles            map[string]*Profile                        //Manifest of device settings per profile
-	Profile             string `json:"-"`                          //The currently loaded profile
+	LineageProfiles     map[string]string `json:"lineage_profiles"` //Profiles per LineageOS profile id, derived from profile_order when unset
+	LineageIds          map[int32]string `json:"-"`                //Profiles per LineageOS profile id, as resolved by initLineage
+	Apps                map[string]string `json:"apps"`             //Profiles per foreground app, by process name or pattern such as "com.example.*"
+	AppsInterval        json.Number `json:"apps_interval"`         //Milliseconds between foreground app checks
+	Sensors             map[string]*VirtualSensor `json:"sensors"`  //Sensors combined from other sensors, usable anywhere a sensor is
+	ThermalUnits        map[string]string `json:"thermal_units"`    //Units of thermal zones that don't report millidegrees, by the zone in their sensor name, such as "battery": "celsius"
+	Rules               []*Rule `json:"rules"`                     //Profiles to switch to automatically from sensor state, evaluated by the daemon in order
+	RulesInterval       json.Number `json:"rules_interval"`        //Milliseconds between rule evaluations
+	Throttle            []*Throttle `json:"throttle"`              //Frequency caps applied in steps as sensors heat up
+	ThrottleInterval    json.Number `json:"throttle_interval"`     //Milliseconds between throttle checks
+	ProfilesResolved    map[string]*Profile `json:"-"`             //Each profile with its parents merged in, resolved once per reload
+	Profile             string `json:"-"`                          //The currently loaded profile, without its overlays
+	ProfileOverlays     []string `json:"-"`                        //Overlay profiles layered on top of Profile, in order
+	ProfileThrottled    bool `json:"-"`                            //Whether thermal throttling capped the loaded profile
+	ProfileApplied      *Profile `json:"-"`                        //The resolved settings of the currently loaded profile, including overlays
 }
 
 type BufferedWrite struct {
@@ -28,6 +55,12 @@ type BufferedWrite struct {
 	Data string
 }
 
+//The kernel rejects a min above the current max and a max below the current min
+type BufferedPair struct {
+	Min string
+	Max string
+}
+
 func (dev *Device) ReadBool(path string) (bool, error) {
 	buffer, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -115,23 +148,107 @@ func (dev *Device) BufferWrite(path string, data string) {
 	}
 }
 
+func (dev *Device) BufferPair(minPath, maxPath string) {
+	if minPath == "" || maxPath == "" {
+		return
+	}
+	for _, pair := range dev.BufferedPairs {
+		if pair.Min == minPath && pair.Max == maxPath {
+			return
+		}
+	}
+	dev.BufferedPairs = append(dev.BufferedPairs, BufferedPair{Min: minPath, Max: maxPath})
+}
+
+//Swaps buffered min and max writes where needed so neither is written past the other's current value
+//Raising the range writes the max first, lowering it below the current min writes the min first
+//When only one of them is written and it would cross the other's current value, the other is moved along with it first
+func (dev *Device) orderPairs() {
+	for _, pair := range dev.BufferedPairs {
+		iMin, iMax := -1, -1
+		for i := 0; i < len(dev.Buffered); i++ {
+			switch dev.Buffered[i].Path {
+			case pair.Min:
+				iMin = i
+			case pair.Max:
+				iMax = i
+			}
+		}
+
+		switch {
+		case iMin == -1 && iMax == -1:
+			continue
+
+		case iMin == -1:
+			newMax, err := strconv.ParseInt(strings.TrimSpace(dev.Buffered[iMax].Data), 10, 64)
+			if err != nil {
+				continue
+			}
+			if oldMin, err := readInt(pair.Min); err == nil && oldMin > newMax {
+				Debug("Lowering %s to %d ahead of %s", pair.Min, newMax, pair.Max)
+				dev.insertBuffered(iMax, BufferedWrite{Path: pair.Min, Data: strconv.FormatInt(newMax, 10)})
+			}
+
+		case iMax == -1:
+			newMin, err := strconv.ParseInt(strings.TrimSpace(dev.Buffered[iMin].Data), 10, 64)
+			if err != nil {
+				continue
+			}
+			if oldMax, err := readInt(pair.Max); err == nil && oldMax < newMin {
+				Debug("Raising %s to %d ahead of %s", pair.Max, newMin, pair.Min)
+				dev.insertBuffered(iMin, BufferedWrite{Path: pair.Max, Data: strconv.FormatInt(newMin, 10)})
+			}
+
+		default:
+			newMax, err := strconv.ParseInt(strings.TrimSpace(dev.Buffered[iMax].Data), 10, 64)
+			if err != nil {
+				continue
+			}
+			oldMin, err := readInt(pair.Min)
+			if err != nil {
+				continue
+			}
+			maxFirst := oldMin <= newMax
+			if (maxFirst && iMax > iMin) || (!maxFirst && iMin > iMax) {
+				Debug("Reordering %s and %s", pair.Min, pair.Max)
+				dev.Buffered[iMin], dev.Buffered[iMax] = dev.Buffered[iMax], dev.Buffered[iMin]
+			}
+		}
+	}
+}
+
+//Buffers write to be synced right before the buffered write at index i
+func (dev *Device) insertBuffered(i int, write BufferedWrite) {
+	buffered := make([]BufferedWrite, 0, len(dev.Buffered) + 1)
+	buffered = append(buffered, dev.Buffered[:i]...)
+	buffered = append(buffered, write)
+	dev.Buffered = append(buffered, dev.Buffered[i:]...)
+}
+
+func readInt(path string) (int64, error) {
+	value, err := readValue(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+}
+
 func (dev *Device) write(path, data string) error {
 	if data == "" {
 		return nil //Skip empty config options
 	}
+	if dev.DryRun {
+		Debug("Dry run, not writing '%s' > %s", data, path)
+		return nil
+	}
 
 	dataBytes := make([]byte, 0)
 	if data != "-" {
 		dataBytes = []byte(data)
 	}
 
-	/*buffer, err := ioutil.ReadFile(path)
-	if err == nil && len(buffer) > 0 && buffer[len(buffer)-1] == '\n' {
-		buffer = buffer[:len(buffer)-1]
-	}
-
-	if string(buffer) == string(dataBytes) {
-		Debug("Skipping reset !> %s", path)
+	if dev.writeUnchanged(path, string(dataBytes)) {
+		Debug("Skipping unchanged '%s' > %s", string(dataBytes), path)
 		return nil
 	}
 
@@ -139,12 +256,14 @@ func (dev *Device) write(path, data string) error {
 		Debug("Writing '%s' > %s", string(dataBytes), path)
 	} else {
 		Debug("Clearing %s", path)
-	}*/
+	}
 
-	//To prevent edge cases with partial applications due to invalid values or inheritance, gracefully log the error and move on
+	//Partial applications are undone by the caller's transaction, so the error has to reach it
 	err := ioutil.WriteFile(path, dataBytes, 0664)
 	if err != nil {
 		Error("Failed writing '%s' > %s: %v", string(dataBytes), path, err)
+		return err
 	}
+	dev.writeCached(path, string(dataBytes))
 	return nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOrderPairs(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max string //Live values
+		buffered []BufferedWrite
+		want     []BufferedWrite
+	}{
+		{
+			name: "raising writes max first",
+			min: "400000", max: "1200000",
+			buffered: []BufferedWrite{{"min", "1400000"}, {"max", "2000000"}},
+			want:     []BufferedWrite{{"max", "2000000"}, {"min", "1400000"}},
+		},
+		{
+			name: "lowering writes min first",
+			min: "1400000", max: "2000000",
+			buffered: []BufferedWrite{{"max", "800000"}, {"min", "400000"}},
+			want:     []BufferedWrite{{"min", "400000"}, {"max", "800000"}},
+		},
+		{
+			name: "already in order",
+			min: "400000", max: "1200000",
+			buffered: []BufferedWrite{{"max", "1600000"}, {"other", "1"}, {"min", "800000"}},
+			want:     []BufferedWrite{{"max", "1600000"}, {"other", "1"}, {"min", "800000"}},
+		},
+		{
+			name: "max below the live min lowers the min first",
+			min: "1400000", max: "2000000",
+			buffered: []BufferedWrite{{"other", "1"}, {"max", "800000"}},
+			want:     []BufferedWrite{{"other", "1"}, {"min", "800000"}, {"max", "800000"}},
+		},
+		{
+			name: "max above the live min is left alone",
+			min: "400000", max: "2000000",
+			buffered: []BufferedWrite{{"max", "800000"}},
+			want:     []BufferedWrite{{"max", "800000"}},
+		},
+		{
+			name: "min above the live max raises the max first",
+			min: "400000", max: "800000",
+			buffered: []BufferedWrite{{"min", "1200000"}},
+			want:     []BufferedWrite{{"max", "1200000"}, {"min", "1200000"}},
+		},
+		{
+			name: "unreadable values are left alone",
+			min: "unknown", max: "2000000",
+			buffered: []BufferedWrite{{"max", "800000"}},
+			want:     []BufferedWrite{{"max", "800000"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			minPath, maxPath := filepath.Join(dir, "min"), filepath.Join(dir, "max")
+			if err := ioutil.WriteFile(minPath, []byte(test.min + "\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(maxPath, []byte(test.max + "\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			inDir := func(writes []BufferedWrite) []BufferedWrite {
+				paths := make([]BufferedWrite, 0, len(writes))
+				for _, write := range writes {
+					paths = append(paths, BufferedWrite{Path: filepath.Join(dir, write.Path), Data: write.Data})
+				}
+				return paths
+			}
+
+			dev := &Device{Buffered: inDir(test.buffered)}
+			dev.BufferPair(minPath, maxPath)
+			dev.orderPairs()
+			if want := inDir(test.want); !reflect.DeepEqual(dev.Buffered, want) {
+				t.Errorf("got %v, want %v", dev.Buffered, want)
+			}
+		})
+	}
+}
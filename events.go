@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType string
+const (
+	EventProfileApplied EventType = "profile_applied"
+	EventApplyFailed    EventType = "apply_failed"
+	EventBootReleased   EventType = "boot_released"
+	EventBoost          EventType = "boost"
+	EventConfigReloaded EventType = "config_reloaded"
+	EventInteractive    EventType = "interactive"
+	EventRule           EventType = "rule"
+	EventThrottle       EventType = "throttle"
+	EventApp            EventType = "app"
+)
+
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	Source  string    `json:"source"`            //What triggered the event, such as "hal", "socket", "boot" or "hint:LOW_POWER"
+	Profile string    `json:"profile,omitempty"`
+	Detail  string    `json:"detail,omitempty"`  //Event specific data, such as a boost duration, the new interactive state or a rule turning on or off
+	Error   string    `json:"error,omitempty"`
+}
+
+var (
+	eventMutex       sync.Mutex
+	eventSubscribers = make(map[chan Event]bool)
+)
+
+//Subscribers must keep up, events are dropped for anyone whose buffer is full
+func subscribe() chan Event {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	events := make(chan Event, 32)
+	eventSubscribers[events] = true
+	return events
+}
+
+func unsubscribe(events chan Event) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	if _, exists := eventSubscribers[events]; exists {
+		delete(eventSubscribers, events)
+		close(events)
+	}
+}
+
+func publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	for events := range eventSubscribers {
+		select {
+		case events <- event:
+		default:
+			Warn("Dropping %s event for a slow subscriber", event.Type)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//Normalizes every profile's extends list and makes sure the inheritance graph is complete and acyclic
+func (dev *Device) initExtends() error {
+	for name, profile := range dev.Profiles {
+		if profile == nil || profile.Extends == nil {
+			continue
+		}
+		for i, parent := range profile.Extends {
+			parent = strings.ReplaceAll(strings.ToLower(parent), " ", "_")
+			if parent == name {
+				return fmt.Errorf("profiles/%s/extends: profile extends itself", name)
+			}
+			if !dev.HasProfile(parent) {
+				return fmt.Errorf("profiles/%s/extends: %w: %s", name, ErrNoProfile, parent)
+			}
+			profile.Extends[i] = parent
+		}
+		Debug("Profile %s extends %s", name, profile.Extends)
+	}
+
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("profiles/%s/extends: inheritance cycle %s", name, strings.Join(path, " -> "))
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+		for _, parent := range dev.profileParents(name) {
+			if err := visit(parent, path); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		return nil
+	}
+	for name := range dev.Profiles {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Returns the profiles that name directly inherits from, in the order they're applied
+//Profiles without extends fall back to every profile before them in profile_inheritance that doesn't declare extends either
+func (dev *Device) profileParents(name string) []string {
+	if profile := dev.Profiles[name]; profile != nil && profile.Extends != nil {
+		return profile.Extends
+	}
+	parents := make([]string, 0)
+	for _, parent := range dev.ProfileInheritance {
+		if parent == name {
+			return parents
+		}
+		if profile := dev.Profiles[parent]; profile != nil && profile.Extends != nil {
+			continue
+		}
+		parents = append(parents, parent)
+	}
+	return nil //Not in the inheritance chain, so it stands alone
+}
+
+//Returns every profile to apply for name, ancestors first and each only once, ending with name itself
+//Later parents in an extends list override earlier ones
+func (dev *Device) profileChain(name string) []string {
+	chain := make([]string, 0)
+	seen := make(map[string]bool)
+	var walk func(name string)
+	walk = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true //Cycles were rejected at reload, this only dedupes shared ancestors
+		for _, parent := range dev.profileParents(name) {
+			walk(parent)
+		}
+		chain = append(chain, name)
+	}
+	walk(name)
+	return chain
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileChain(t *testing.T) {
+	dev := &Device{
+		ProfileInheritance: []string{"screen_off", "balanced", "performance", "gaming"},
+		Profiles: map[string]*Profile{
+			"screen_off":  {},
+			"balanced":    {},
+			"performance": {},
+			"gaming":      {Extends: []string{"performance"}},
+			"camera":      {Extends: []string{"balanced", "performance"}},
+			"video":       {Extends: []string{"camera", "performance"}},
+			"standalone":  {},
+		},
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"screen_off", []string{"screen_off"}},
+		{"performance", []string{"screen_off", "balanced", "performance"}},
+		//Extends replaces profile_inheritance, and profiles that declare it are skipped by the ones after them
+		{"gaming", []string{"screen_off", "balanced", "performance", "gaming"}},
+		{"camera", []string{"screen_off", "balanced", "performance", "camera"}},
+		//Shared ancestors are only applied once, where they're first reached
+		{"video", []string{"screen_off", "balanced", "performance", "camera", "video"}},
+		{"standalone", []string{"standalone"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := dev.profileChain(test.name); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
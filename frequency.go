@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//A frequency as written in the manifest, resolved against the hardware only when it's applied:
+//- 1600000: written as is, in the unit of the node
+//- "max", "min": the highest or lowest frequency supported
+//- "80%": a percentage of the highest frequency supported
+//- "level:2", "level:-2": an index into the supported frequencies, counting down from the highest when negative
+//- "1.5GHz", "800MHz", "400000kHz", "100000000Hz": an absolute frequency converted to the unit of the node
+//Everything but exact values is snapped to the nearest supported frequency
+type Frequency string
+
+const (
+	FREQ_EXACT = iota
+	FREQ_MAX
+	FREQ_MIN
+	FREQ_PERCENT
+	FREQ_LEVEL
+	FREQ_HZ
+)
+
+var frequencyUnits = []struct {
+	Suffix string
+	Hz     float64
+}{
+	{"ghz", 1000000000},
+	{"mhz", 1000000},
+	{"khz", 1000},
+	{"hz", 1},
+}
+
+func (freq *Frequency) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		//Exact values are written as is, so they have to be whole numbers in the node's unit
+		if _, _, err := parseFrequency(number.String()); err != nil {
+			return err
+		}
+		*freq = Frequency(number.String())
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("frequency must be a number or string: %s", string(data))
+	}
+	if _, _, err := parseFrequency(str); err != nil {
+		return err
+	}
+	*freq = Frequency(str)
+	return nil
+}
+
+func (freq Frequency) MarshalJSON() ([]byte, error) {
+	if kind, _, err := parseFrequency(string(freq)); err == nil && kind == FREQ_EXACT {
+		return []byte(strings.TrimSpace(string(freq))), nil
+	}
+	return json.Marshal(string(freq))
+}
+
+func (freq Frequency) String() string {
+	return string(freq)
+}
+
+func parseFrequency(value string) (int, float64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "max":
+		return FREQ_MAX, 0, nil
+	case value == "min":
+		return FREQ_MIN, 0, nil
+
+	case strings.HasSuffix(value, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+		if err != nil || percent < 0 {
+			return 0, 0, fmt.Errorf("invalid frequency percentage %s", value)
+		}
+		return FREQ_PERCENT, percent, nil
+
+	case strings.HasPrefix(value, "level:"):
+		level, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(value, "level:")))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid frequency level %s", value)
+		}
+		return FREQ_LEVEL, float64(level), nil
+	}
+
+	for _, unit := range frequencyUnits {
+		if strings.HasSuffix(value, unit.Suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, unit.Suffix)), 64)
+			if err != nil || number < 0 {
+				return 0, 0, fmt.Errorf("invalid frequency %s", value)
+			}
+			return FREQ_HZ, number * unit.Hz, nil
+		}
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid frequency %s", value)
+	}
+	return FREQ_EXACT, float64(number), nil
+}
+
+//The frequencies a node accepts, in the node's own unit
+type FrequencyDomain struct {
+	Min   int64
+	Max   int64
+	Steps []int64 //Supported frequencies in ascending order, if the hardware lists them
+	Unit  int64   //Hz per unit of the node
+}
+
+//Returns the value to write for freq, or an empty string if it's unset
+func (freq Frequency) Resolve(domain *FrequencyDomain) (string, error) {
+	if freq == "" {
+		return "", nil
+	}
+	kind, number, err := parseFrequency(string(freq))
+	if err != nil {
+		return "", err
+	}
+	if kind == FREQ_EXACT {
+		return strconv.FormatInt(int64(number), 10), nil
+	}
+	if domain == nil || domain.Max <= 0 {
+		return "", fmt.Errorf("can't resolve frequency %s without knowing the supported frequencies", freq)
+	}
+
+	var target float64
+	switch kind {
+	case FREQ_MAX:
+		return strconv.FormatInt(domain.Max, 10), nil
+	case FREQ_MIN:
+		return strconv.FormatInt(domain.Min, 10), nil
+	case FREQ_PERCENT:
+		target = float64(domain.Max) * number / 100
+	case FREQ_LEVEL:
+		if len(domain.Steps) == 0 {
+			return "", fmt.Errorf("can't resolve frequency %s without a frequency table", freq)
+		}
+		level := int(number)
+		if level < 0 {
+			level += len(domain.Steps)
+		}
+		if level < 0 || level >= len(domain.Steps) {
+			return "", fmt.Errorf("frequency %s is out of range, only %d levels are available", freq, len(domain.Steps))
+		}
+		return strconv.FormatInt(domain.Steps[level], 10), nil
+	case FREQ_HZ:
+		target = number / float64(domain.Unit)
+	}
+	return strconv.FormatInt(domain.snap(target), 10), nil
+}
+
+//Returns the supported frequency nearest to target, preferring the lower one on ties
+func (domain *FrequencyDomain) snap(target float64) int64 {
+	if len(domain.Steps) == 0 {
+		return int64(math.Round(math.Max(float64(domain.Min), math.Min(float64(domain.Max), target))))
+	}
+	best := domain.Steps[0]
+	for _, step := range domain.Steps[1:] {
+		if math.Abs(float64(step) - target) < math.Abs(float64(best) - target) {
+			best = step
+		}
+	}
+	return best
+}
+
+//Reads the limits and frequency table of a node, any of which may be missing
+func readFrequencyDomain(minPath, maxPath, tablePath string, unit int64) *FrequencyDomain {
+	domain := &FrequencyDomain{Unit: unit}
+	if tablePath != "" {
+		if buffer, err := ioutil.ReadFile(tablePath); err == nil {
+			for _, field := range strings.Fields(string(buffer)) {
+				if step, err := strconv.ParseInt(field, 10, 64); err == nil && step > 0 {
+					domain.Steps = append(domain.Steps, step)
+				}
+			}
+			sort.Slice(domain.Steps, func(i, j int) bool { return domain.Steps[i] < domain.Steps[j] })
+		}
+	}
+	if len(domain.Steps) > 0 {
+		domain.Min, domain.Max = domain.Steps[0], domain.Steps[len(domain.Steps)-1]
+	}
+	if minPath != "" {
+		if value, err := readValue(minPath); err == nil {
+			if min, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				domain.Min = min
+			}
+		}
+	}
+	if maxPath != "" {
+		if value, err := readValue(maxPath); err == nil {
+			if max, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				domain.Max = max
+			}
+		}
+	}
+	return domain
+}
+
+//Returns the frequencies supported by a cluster, read once per reload
+func (dev *Device) cpuFreqDomain(clusterName string) *FrequencyDomain {
+	key := "clusters/" + clusterName
+	if domain, exists := dev.FreqDomains[key]; exists {
+		return domain
+	}
+	pathCluster := dev.Paths.Clusters[clusterName]
+	pathFreq := pathCluster.CPUFreq
+	if pathFreq == nil {
+		return nil
+	}
+	freqPath := pathJoin(pathCluster.Path, pathFreq.Path)
+	domainPath := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		return pathJoin(freqPath, path)
+	}
+	domain := readFrequencyDomain(domainPath(pathFreq.InfoMin), domainPath(pathFreq.InfoMax), domainPath(pathFreq.Frequencies), 1000) //cpufreq uses kHz
+	Debug("Frequencies for %s: %d-%d %v", key, domain.Min, domain.Max, domain.Steps)
+	dev.cacheFreqDomain(key, domain)
+	return domain
+}
+
+//Returns the frequencies supported by the GPU's DVFS locks, read once per reload
+func (dev *Device) gpuFreqDomain() *FrequencyDomain {
+	key := "gpu/dvfs"
+	if domain, exists := dev.FreqDomains[key]; exists {
+		return domain
+	}
+	if dev.Paths.GPU == nil || dev.Paths.GPU.DVFS == nil {
+		return nil
+	}
+	dvfs := dev.Paths.GPU.DVFS
+	unit := int64(1000000) //universal7420: Mali DVFS locks use MHz
+	switch strings.ToLower(dvfs.Unit) {
+	case "hz":
+		unit = 1
+	case "khz":
+		unit = 1000
+	}
+	tablePath := ""
+	if dvfs.Table != "" {
+		tablePath = pathJoin(dev.Paths.GPU.Path, dvfs.Table)
+	}
+	domain := readFrequencyDomain("", "", tablePath, unit)
+	Debug("Frequencies for %s: %d-%d %v", key, domain.Min, domain.Max, domain.Steps)
+	dev.cacheFreqDomain(key, domain)
+	return domain
+}
+
+func (dev *Device) cacheFreqDomain(key string, domain *FrequencyDomain) {
+	if dev.FreqDomains == nil {
+		dev.FreqDomains = make(map[string]*FrequencyDomain)
+	}
+	dev.FreqDomains[key] = domain
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFrequency(t *testing.T) {
+	tests := []struct {
+		value  string
+		kind   int
+		number float64
+		fails  bool
+	}{
+		{value: "1600000", kind: FREQ_EXACT, number: 1600000},
+		{value: " 1600000 ", kind: FREQ_EXACT, number: 1600000},
+		{value: "max", kind: FREQ_MAX},
+		{value: "MIN", kind: FREQ_MIN},
+		{value: "80%", kind: FREQ_PERCENT, number: 80},
+		{value: "12.5 %", kind: FREQ_PERCENT, number: 12.5},
+		{value: "level:2", kind: FREQ_LEVEL, number: 2},
+		{value: "level:-2", kind: FREQ_LEVEL, number: -2},
+		{value: "1.5GHz", kind: FREQ_HZ, number: 1500000000},
+		{value: "800MHz", kind: FREQ_HZ, number: 800000000},
+		{value: "400000kHz", kind: FREQ_HZ, number: 400000000},
+		{value: "100000000Hz", kind: FREQ_HZ, number: 100000000},
+		{value: "", fails: true},
+		{value: "fast", fails: true},
+		{value: "-5%", fails: true},
+		{value: "level:top", fails: true},
+		{value: "-1GHz", fails: true},
+		{value: "1.5", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			kind, number, err := parseFrequency(test.value)
+			if test.fails {
+				if err == nil {
+					t.Errorf("got kind %d and %v, want an error", kind, number)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kind != test.kind || number != test.number {
+				t.Errorf("got kind %d and %v, want kind %d and %v", kind, number, test.kind, test.number)
+			}
+		})
+	}
+}
+
+func TestFrequencyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json  string
+		want  Frequency
+		fails bool
+	}{
+		{json: `1600000`, want: "1600000"},
+		{json: `"1600000"`, want: "1600000"},
+		{json: `"max"`, want: "max"},
+		{json: `"80%"`, want: "80%"},
+		{json: `"1.5GHz"`, want: "1.5GHz"},
+		{json: `1.5`, fails: true},
+		{json: `1e6`, fails: true},
+		{json: `-1`, want: "-1"},
+		{json: `"fast"`, fails: true},
+		{json: `true`, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.json, func(t *testing.T) {
+			var freq Frequency
+			err := json.Unmarshal([]byte(test.json), &freq)
+			if test.fails {
+				if err == nil {
+					t.Errorf("got %q, want an error", freq)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if freq != test.want {
+				t.Errorf("got %q, want %q", freq, test.want)
+			}
+		})
+	}
+}
+
+func TestFrequencyResolve(t *testing.T) {
+	table := &FrequencyDomain{Min: 400000, Max: 2100000, Steps: []int64{400000, 800000, 1200000, 1600000, 2100000}, Unit: 1000}
+	limits := &FrequencyDomain{Min: 100, Max: 700, Unit: 1000000}
+	tests := []struct {
+		name   string
+		freq   Frequency
+		domain *FrequencyDomain
+		want   string
+		fails  bool
+	}{
+		{name: "unset", freq: "", domain: table, want: ""},
+		{name: "exact is written as is", freq: "1000000", domain: table, want: "1000000"},
+		{name: "exact without a domain", freq: "1000000", domain: nil, want: "1000000"},
+		{name: "max", freq: "max", domain: table, want: "2100000"},
+		{name: "min", freq: "min", domain: table, want: "400000"},
+		{name: "percent snaps", freq: "50%", domain: table, want: "1200000"},
+		{name: "level", freq: "level:1", domain: table, want: "800000"},
+		{name: "level from the top", freq: "level:-1", domain: table, want: "2100000"},
+		{name: "level out of range", freq: "level:5", domain: table, fails: true},
+		{name: "level without a table", freq: "level:0", domain: limits, fails: true},
+		{name: "hz converts and snaps", freq: "1.3GHz", domain: table, want: "1200000"},
+		{name: "hz in another unit", freq: "350MHz", domain: limits, want: "350"},
+		{name: "hz clamps without a table", freq: "1GHz", domain: limits, want: "700"},
+		{name: "relative without a domain", freq: "max", domain: nil, fails: true},
+		{name: "relative without limits", freq: "80%", domain: &FrequencyDomain{Unit: 1000}, fails: true},
+		{name: "invalid", freq: "fast", domain: table, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.freq.Resolve(test.domain)
+			if test.fails {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFrequencyDomainSnap(t *testing.T) {
+	table := &FrequencyDomain{Min: 400000, Max: 1600000, Steps: []int64{400000, 800000, 1200000, 1600000}}
+	limits := &FrequencyDomain{Min: 100, Max: 700}
+	tests := []struct {
+		name   string
+		domain *FrequencyDomain
+		target float64
+		want   int64
+	}{
+		{"exact step", table, 800000, 800000},
+		{"nearest step", table, 1100000, 1200000},
+		{"tie prefers lower", table, 1000000, 800000},
+		{"below the table", table, 100000, 400000},
+		{"above the table", table, 3000000, 1600000},
+		{"rounds within limits", limits, 350.6, 351},
+		{"clamps to min", limits, 50, 100},
+		{"clamps to max", limits, 900, 700},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.domain.snap(test.target); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
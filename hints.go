@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HINT_ACTION_PROFILE = "profile" //Switch to Profile while the hint is on, and reset back when it's off
+	HINT_ACTION_OVERLAY = "overlay" //Layer Profile on top of the current profile while the hint is on
+	HINT_ACTION_BOOST   = "boost"   //Boost for Duration microseconds when the hint is on
+	HINT_ACTION_IGNORE  = "ignore"  //Accept the hint and do nothing
+)
+
+//Hints are keyed by hint, mode or boost name, such as "CAMERA_STREAMING", "GAME" or "ML_ACC"
+//Names shared by hints, modes and boosts can be told apart with a "hint:", "mode:" or "boost:" prefix, which takes priority
+//Boosts only last for their duration, so profiles and overlays they turn on are turned off again when it's over
+type HintAction struct {
+	Action string
+	Profile string
+	Duration json.Number //Microseconds, or the governor's boostpulse_duration when unset
+	Priority json.Number //Where the profile or overlay sits among other overlays, see the OVERLAY_PRIORITY constants
+}
+
+func (action *HintAction) priority(fallback int) int {
+	if priority, err := action.Priority.Int64(); err == nil {
+		return int(priority)
+	}
+	return fallback
+}
+
+func (dev *Device) initHints() error {
+	if dev.Hints == nil {
+		dev.Hints = make(map[string]*HintAction)
+		return nil
+	}
+	hints := make(map[string]*HintAction)
+	for key, action := range dev.Hints {
+		//Stored by the names GetHintAction looks up, however the manifest spells them
+		name := strings.ToUpper(key)
+		switch {
+		case strings.HasPrefix(name, "HINT_"):
+			name = "HINT:" + name
+			fallthrough
+		case strings.HasPrefix(name, "HINT:"):
+			hint, err := ParsePowerHint(strings.TrimPrefix(name, "HINT:"))
+			if err != nil {
+				return fmt.Errorf("hints/%s: %v", key, err)
+			}
+			name = "HINT:" + hint.String()
+		case strings.HasPrefix(name, "MODE_"):
+			name = "MODE:" + name
+			fallthrough
+		case strings.HasPrefix(name, "MODE:"):
+			mode, err := ParsePowerMode(strings.TrimPrefix(name, "MODE:"))
+			if err != nil {
+				return fmt.Errorf("hints/%s: %v", key, err)
+			}
+			name = "MODE:" + mode.String()
+		case strings.HasPrefix(name, "BOOST_"):
+			name = "BOOST:" + name
+			fallthrough
+		case strings.HasPrefix(name, "BOOST:"):
+			boost, err := ParsePowerBoost(strings.TrimPrefix(name, "BOOST:"))
+			if err != nil {
+				return fmt.Errorf("hints/%s: %v", key, err)
+			}
+			name = "BOOST:" + boost.String()
+		default:
+			if _, err := strconv.ParseInt(name, 0, 32); err == nil {
+				return fmt.Errorf("hints/%s: ids are ambiguous without HINT:, MODE: or BOOST:", key)
+			}
+			hint, errHint := ParsePowerHint(name)
+			mode, errMode := ParsePowerMode(name)
+			boost, errBoost := ParsePowerBoost(name)
+			switch {
+			case errHint == nil:
+				name = hint.String()
+			case errMode == nil:
+				name = mode.String()
+			case errBoost == nil:
+				name = boost.String()
+			default:
+				return fmt.Errorf("hints/%s: unknown power hint, mode or boost", key)
+			}
+		}
+		if _, exists := hints[name]; exists {
+			return fmt.Errorf("hints/%s: %s is already configured", key, name)
+		}
+		if action == nil {
+			return fmt.Errorf("hints/%s: missing action", key)
+		}
+
+		action.Action = strings.ToLower(action.Action)
+		switch action.Action {
+		case HINT_ACTION_PROFILE, HINT_ACTION_OVERLAY:
+			action.Profile = strings.ReplaceAll(strings.ToLower(action.Profile), " ", "_")
+			if !dev.HasProfile(action.Profile) {
+				return fmt.Errorf("hints/%s: %w: %s", key, ErrNoProfile, action.Profile)
+			}
+		case HINT_ACTION_BOOST:
+			if action.Duration.String() != "" {
+				if _, err := action.Duration.Int64(); err != nil {
+					return fmt.Errorf("hints/%s: invalid boost duration %s", key, action.Duration)
+				}
+			}
+		case HINT_ACTION_IGNORE:
+		default:
+			return fmt.Errorf("hints/%s: unknown action %s", key, action.Action)
+		}
+		if action.Priority.String() != "" {
+			if _, err := action.Priority.Int64(); err != nil {
+				return fmt.Errorf("hints/%s: invalid priority %s", key, action.Priority)
+			}
+		}
+		hints[name] = action
+		Debug("Found hint %s: %s %s", name, action.Action, action.Profile)
+	}
+	dev.Hints = hints
+	return nil
+}
+
+//Returns the action for the first key configured in the manifest, or nil to use the default
+func (dev *Device) GetHintAction(keys ...string) *HintAction {
+	for _, key := range keys {
+		if action, exists := dev.Hints[key]; exists {
+			return action
+		}
+	}
+	return nil
+}
+
+func doHintAction(action *HintAction, enabled bool, source string) error {
+	switch action.Action {
+	case HINT_ACTION_PROFILE:
+		if enabled {
+			return addOverlay(Overlay{Source: source, Profile: action.Profile, Priority: action.priority(defaultPriority(action.Profile)), Replace: true})
+		}
+		return removeOverlay(source)
+
+	case HINT_ACTION_OVERLAY:
+		if enabled {
+			return addOverlay(Overlay{Source: source, Profile: action.Profile, Priority: action.priority(OVERLAY_PRIORITY_HINT)})
+		}
+		return removeOverlay(source)
+
+	case HINT_ACTION_BOOST:
+		if enabled {
+			duration, _ := action.Duration.Int64()
+			boost(int32(duration), source)
+		}
+		return nil
+	}
+	return nil
+}
+
+var (
+	boostTimersMutex sync.Mutex
+	boostTimers = make(map[string]*time.Timer) //Turns off the profile or overlay of each boost source when it's over
+)
+
+//Boosts for durationMs, or the action's own duration when the boost doesn't have one
+func doBoostAction(action *HintAction, durationMs int32, source string) error {
+	durationUs := int64(durationMs) * 1000
+	if durationUs <= 0 {
+		durationUs, _ = action.Duration.Int64()
+	}
+	switch action.Action {
+	case HINT_ACTION_PROFILE, HINT_ACTION_OVERLAY:
+		if durationUs <= 0 {
+			return fmt.Errorf("boost %s needs a duration to turn off profile %s again", source, action.Profile)
+		}
+		if err := doHintAction(action, true, source); err != nil && !errors.Is(err, ErrLocked) {
+			return err
+		}
+		//Boosts that arrive before the last one is over extend it
+		boostTimersMutex.Lock()
+		defer boostTimersMutex.Unlock()
+		if timer, exists := boostTimers[source]; exists {
+			timer.Stop()
+		}
+		boostTimers[source] = time.AfterFunc(time.Microsecond * time.Duration(durationUs), func() {
+			boostTimersMutex.Lock()
+			delete(boostTimers, source)
+			boostTimersMutex.Unlock()
+			if err := doHintAction(action, false, source); err != nil && !errors.Is(err, ErrLocked) {
+				Warn("Failed to end boost %s: %v", source, err)
+			}
+		})
+		return nil
+
+	case HINT_ACTION_BOOST:
+		boost(int32(durationUs), source)
+	}
+	return nil
+}
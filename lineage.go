@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+//Performance profile ids sent by LineageOS with HINT_LINEAGE_SET_PROFILE
+const (
+	LINEAGE_PROFILE_SCREEN_OFF       = -1 //Not sent by the framework, kept for callers that relied on it
+	LINEAGE_PROFILE_POWER_SAVE       = 0
+	LINEAGE_PROFILE_BALANCED         = 1
+	LINEAGE_PROFILE_HIGH_PERFORMANCE = 2
+	LINEAGE_PROFILE_BIAS_POWER_SAVE  = 3
+	LINEAGE_PROFILE_BIAS_PERFORMANCE = 4
+)
+
+//Lineage ids from lowest to highest performing, a framework told we support N profiles sends the first N ids
+var lineageRank = []int32{
+	LINEAGE_PROFILE_POWER_SAVE,
+	LINEAGE_PROFILE_BIAS_POWER_SAVE,
+	LINEAGE_PROFILE_BALANCED,
+	LINEAGE_PROFILE_BIAS_PERFORMANCE,
+	LINEAGE_PROFILE_HIGH_PERFORMANCE,
+}
+
+//Builds the Lineage id to profile mapping from lineage_profiles, or from the profile order when it isn't set
+//The ids have to count up from 0 without gaps, as that's all the framework can ask for
+func (dev *Device) initLineage() error {
+	dev.LineageIds = make(map[int32]string)
+	if len(dev.LineageProfiles) > 0 {
+		for key, profile := range dev.LineageProfiles {
+			id, err := strconv.ParseInt(key, 10, 32)
+			if err != nil || id < LINEAGE_PROFILE_SCREEN_OFF {
+				return fmt.Errorf("lineage_profiles/%s: invalid profile id", key)
+			}
+			if _, exists := dev.LineageIds[int32(id)]; exists {
+				return fmt.Errorf("lineage_profiles/%s: duplicate profile id", key)
+			}
+			if !dev.HasProfile(profile) {
+				return fmt.Errorf("lineage_profiles/%s: %w: %s", key, ErrNoProfile, profile)
+			}
+			dev.LineageIds[int32(id)] = profile
+		}
+		for id := int32(0); id < dev.lineageSupported(); id++ {
+			if _, exists := dev.LineageIds[id]; !exists {
+				return fmt.Errorf("lineage_profiles: missing profile id %d, ids must count up from 0", id)
+			}
+		}
+	} else {
+		order := dev.ProfileOrder
+		if len(order) > len(lineageRank) {
+			//Keep the highest performing profiles, the lowest ones are most likely boot or special purpose profiles
+			Warn("Lineage supports %d profiles, not mapping %s", len(lineageRank), order[:len(order)-len(lineageRank)])
+			order = order[len(order)-len(lineageRank):]
+		}
+		//Rank the ids the framework will send by performance, then hand them out along the profile order
+		ids := make([]int32, len(order))
+		for id := range ids {
+			ids[id] = int32(id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return lineageRankOf(ids[i]) < lineageRankOf(ids[j]) })
+		for i, id := range ids {
+			dev.LineageIds[id] = order[i]
+		}
+		if dev.HasProfile("screen_off") {
+			dev.LineageIds[LINEAGE_PROFILE_SCREEN_OFF] = "screen_off"
+		}
+	}
+	Debug("Lineage profiles: %v", dev.LineageIds)
+	return nil
+}
+
+func lineageRankOf(id int32) int {
+	for rank, ranked := range lineageRank {
+		if ranked == id {
+			return rank
+		}
+	}
+	return len(lineageRank) + int(id)
+}
+
+//Returns how many profiles the framework can pick from, being ids 0 to N-1
+func (dev *Device) lineageSupported() int32 {
+	supported := int32(0)
+	for id := range dev.LineageIds {
+		if id >= 0 {
+			supported++
+		}
+	}
+	return supported
+}
+
+func (dev *Device) LineageProfile(id int32) (string, error) {
+	if profile, exists := dev.LineageIds[id]; exists {
+		return profile, nil
+	}
+	return "", fmt.Errorf("%w: lineage profile id %d", ErrUnsupported, id)
+}
+
+//Returns the Lineage id mapped to the profile, or false if the framework can't select it
+func (dev *Device) LineageId(profile string) (int32, bool) {
+	for id, mapped := range dev.LineageIds {
+		if mapped == profile {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+//Returns the mapping keyed by id, the way lineage_profiles is written in the manifest
+func (dev *Device) lineageTable() map[string]string {
+	table := make(map[string]string, len(dev.LineageIds))
+	for id, profile := range dev.LineageIds {
+		table[strconv.Itoa(int(id))] = profile
+	}
+	return table
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInitLineage(t *testing.T) {
+	profiles := map[string]*Profile{
+		"screen_off": {}, "battery_saver": {}, "efficiency": {}, "balanced": {}, "quick": {}, "performance": {}, "bootpulse": {},
+	}
+	tests := []struct {
+		name     string
+		order    []string
+		table    map[string]string //lineage_profiles
+		profiles map[string]*Profile
+		want     map[int32]string
+		fails    bool
+	}{
+		{
+			name:     "three profiles count up",
+			order:    []string{"battery_saver", "balanced", "performance"},
+			profiles: map[string]*Profile{"battery_saver": {}, "balanced": {}, "performance": {}},
+			want:     map[int32]string{0: "battery_saver", 1: "balanced", 2: "performance"},
+		},
+		{
+			name:  "five profiles are ranked by performance",
+			order: []string{"battery_saver", "efficiency", "balanced", "quick", "performance"},
+			want: map[int32]string{
+				LINEAGE_PROFILE_SCREEN_OFF:       "screen_off",
+				LINEAGE_PROFILE_POWER_SAVE:       "battery_saver",
+				LINEAGE_PROFILE_BIAS_POWER_SAVE:  "efficiency",
+				LINEAGE_PROFILE_BALANCED:         "balanced",
+				LINEAGE_PROFILE_BIAS_PERFORMANCE: "quick",
+				LINEAGE_PROFILE_HIGH_PERFORMANCE: "performance",
+			},
+		},
+		{
+			name:  "four profiles use the first four ids",
+			order: []string{"battery_saver", "balanced", "quick", "performance"},
+			want:  map[int32]string{-1: "screen_off", 0: "battery_saver", 3: "balanced", 1: "quick", 2: "performance"},
+		},
+		{
+			name:  "the lowest profiles are dropped past five",
+			order: []string{"bootpulse", "battery_saver", "efficiency", "balanced", "quick", "performance"},
+			want:  map[int32]string{-1: "screen_off", 0: "battery_saver", 3: "efficiency", 1: "balanced", 4: "quick", 2: "performance"},
+		},
+		{
+			name:  "lineage_profiles replaces the order",
+			order: []string{"battery_saver", "balanced", "performance"},
+			table: map[string]string{"0": "efficiency", "1": "quick"},
+			want:  map[int32]string{0: "efficiency", 1: "quick"},
+		},
+		{name: "invalid id", table: map[string]string{"0": "balanced", "power": "performance"}, fails: true},
+		{name: "id below screen off", table: map[string]string{"-2": "balanced"}, fails: true},
+		{name: "duplicate id", table: map[string]string{"0": "balanced", "00": "performance"}, fails: true},
+		{name: "missing profile", table: map[string]string{"0": "gaming"}, fails: true},
+		{name: "gap in the ids", table: map[string]string{"0": "balanced", "2": "performance"}, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dev := &Device{ProfileOrder: test.order, LineageProfiles: test.table, Profiles: test.profiles}
+			if dev.Profiles == nil {
+				dev.Profiles = profiles
+			}
+			err := dev.initLineage()
+			if test.fails {
+				if err == nil {
+					t.Errorf("got %v, want an error", dev.LineageIds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(dev.LineageIds, test.want) {
+				t.Errorf("got %v, want %v", dev.LineageIds, test.want)
+			}
+		})
+	}
+}
+
+func TestLineageSupported(t *testing.T) {
+	dev := &Device{LineageIds: map[int32]string{-1: "screen_off", 0: "battery_saver", 1: "balanced", 2: "performance"}}
+	if got := dev.lineageSupported(); got != 3 {
+		t.Errorf("got %d supported, screen off isn't sent by the framework so want 3", got)
+	}
+	if profile, err := dev.LineageProfile(1); err != nil || profile != "balanced" {
+		t.Errorf("got %s and %v for id 1, want balanced", profile, err)
+	}
+	if _, err := dev.LineageProfile(3); err == nil {
+		t.Error("got a profile for unmapped id 3")
+	}
+	if id, exists := dev.LineageId("performance"); !exists || id != 2 {
+		t.Errorf("got id %d and %t for performance, want 2", id, exists)
+	}
+}
@@ -20,6 +20,9 @@ const (
 )
 
 func parseMsg(prio LogPriority, format string, replacements ...any) {
+	if quiet && prio < LogFatal {
+		return
+	}
 	if replacements == nil || len(replacements) < 1 {
 		replacements = []any{format}
 		format = "%v"
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+//Written in place of a value to drop whatever a parent profile set there
+const PROFILE_UNSET = "unset"
+
+//Parses a profile, recording every value set to null or "unset" so merging can drop it from the parents
+func (profile *Profile) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	unset := make([]string, 0)
+	raw = stripUnset(raw, reflect.TypeOf(Profile{}), "", &unset)
+	cleaned, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	type profileJSON Profile //Same fields without this method, to avoid recursing
+	parsed := profileJSON{}
+	if err := json.Unmarshal(cleaned, &parsed); err != nil {
+		return err
+	}
+	*profile = Profile(parsed)
+	if len(unset) > 0 {
+		profile.Unset = unset
+	}
+	return nil
+}
+
+func isUnset(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	str, isString := value.(string)
+	return isString && strings.ToLower(str) == PROFILE_UNSET
+}
+
+//Removes unset markers from the raw JSON tree of type t, appending their paths to unset
+func stripUnset(value interface{}, t reflect.Type, path string, unset *[]string) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	obj, isObject := value.(map[string]interface{})
+	if !isObject {
+		return value
+	}
+
+	for key, v := range obj {
+		var segment string
+		var elemType reflect.Type
+		switch t.Kind() {
+		case reflect.Struct:
+			field, exists := profileField(t, key)
+			if !exists {
+				continue //Left for the decoder to ignore
+			}
+			segment, elemType = fieldName(field), field.Type
+		case reflect.Map:
+			segment, elemType = key, t.Elem()
+		default:
+			continue
+		}
+
+		if isUnset(v) {
+			Debug("Unsetting %s%s", path, segment)
+			*unset = append(*unset, path+segment)
+			delete(obj, key)
+			continue
+		}
+		obj[key] = stripUnset(v, elemType, path+segment+"/", unset)
+	}
+	return obj
+}
+
+//Finds the field that a JSON key decodes into, matching case insensitively like encoding/json
+func profileField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if strings.EqualFold(fieldName(field), key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return strings.ToLower(name)
+}
+
+//Merges the parsed settings of src into dst, dropping src's unset paths from dst first
+func mergeProfile(dst, src *Profile) {
+	for _, path := range src.Unset {
+		unsetValue(reflect.ValueOf(dst).Elem(), strings.Split(path, "/"))
+	}
+	mergeValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+}
+
+//Zero values in src mean inherit, maps merge by key and anything else set in src replaces dst
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(deepCopy(src))
+			return
+		}
+		mergeValue(dst.Elem(), src.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			field := src.Type().Field(i)
+			if field.PkgPath != "" || field.Tag.Get("merge") == "-" {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			existing := dst.MapIndex(iter.Key())
+			if !existing.IsValid() {
+				dst.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+				continue
+			}
+			//Map values aren't addressable, so merge into a copy and store it back
+			merged := reflect.New(existing.Type()).Elem()
+			merged.Set(existing)
+			mergeValue(merged, iter.Value())
+			dst.SetMapIndex(iter.Key(), merged)
+		}
+
+	default:
+		if !src.IsZero() {
+			dst.Set(deepCopy(src))
+		}
+	}
+}
+
+//Clears the value at path, deleting it from its map or zeroing its field
+func unsetValue(v reflect.Value, path []string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, exists := profileField(v.Type(), path[0])
+		if !exists {
+			return
+		}
+		fv := v.FieldByIndex(field.Index)
+		if len(path) == 1 {
+			fv.Set(reflect.Zero(fv.Type()))
+			return
+		}
+		unsetValue(fv, path[1:])
+
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		key := reflect.ValueOf(path[0])
+		if len(path) == 1 {
+			v.SetMapIndex(key, reflect.Value{})
+			return
+		}
+		existing := v.MapIndex(key)
+		if !existing.IsValid() {
+			return
+		}
+		changed := reflect.New(existing.Type()).Elem()
+		changed.Set(existing)
+		unsetValue(changed, path[1:])
+		v.SetMapIndex(key, changed)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseTestProfile(t *testing.T, data string) *Profile {
+	t.Helper()
+	profile := &Profile{}
+	if err := json.Unmarshal([]byte(data), profile); err != nil {
+		t.Fatalf("failed to parse profile %s: %v", data, err)
+	}
+	return profile
+}
+
+//Compares profiles by their JSON, so pointers and map order don't matter
+func profileJSON(t *testing.T, profile *Profile) string {
+	t.Helper()
+	data, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatalf("failed to marshal profile: %v", err)
+	}
+	return string(data)
+}
+
+func TestMergeProfile(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		child  string
+		want   string
+	}{
+		{
+			name:   "inherit",
+			parent: `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"min":400000}}}}`,
+			child:  `{}`,
+			want:   `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"min":400000}}}}`,
+		},
+		{
+			name:   "override",
+			parent: `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"min":400000}}}}`,
+			child:  `{"clusters":{"apollo":{"cpufreq":{"max":"max"}}}}`,
+			want:   `{"clusters":{"apollo":{"cpufreq":{"max":"max","min":400000}}}}`,
+		},
+		{
+			name:   "map merge",
+			parent: `{"clusters":{"apollo":{"cpufreq":{"governors":{"interactive":{"io_is_busy":false}}}}},"cpusets":{"top-app":{"cpus":"0-7"}}}`,
+			child:  `{"clusters":{"atlas":{"cpufreq":{"max":1200000}},"apollo":{"cpufreq":{"governors":{"interactive":{"hispeed_freq":900000}}}}},"cpusets":{"background":{"cpus":"0-3"}}}`,
+			want:   `{"clusters":{"apollo":{"cpufreq":{"governors":{"interactive":{"hispeed_freq":900000,"io_is_busy":false}}}},"atlas":{"cpufreq":{"max":1200000}}},"cpusets":{"background":{"cpus":"0-3"},"top-app":{"cpus":"0-7"}}}`,
+		},
+		{
+			name:   "null drops",
+			parent: `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"min":400000}}}}`,
+			child:  `{"clusters":{"apollo":{"cpufreq":{"max":null}}}}`,
+			want:   `{"clusters":{"apollo":{"cpufreq":{"min":400000}}}}`,
+		},
+		{
+			name:   "unset drops",
+			parent: `{"clusters":{"apollo":{"cpufreq":{"governors":{"interactive":{"io_is_busy":false}}}}},"cpusets":{"top-app":{"cpus":"0-7"}}}`,
+			child:  `{"clusters":{"apollo":{"cpufreq":{"governors":{"interactive":"Unset"}}}},"cpusets":"unset"}`,
+			want:   `{"clusters":{"apollo":{"cpufreq":{}}}}`,
+		},
+		{
+			name:   "unset then set",
+			parent: `{"gpu":{"dvfs":{"max":700}}}`,
+			child:  `{"gpu":{"dvfs":{"max":"unset","min":100}}}`,
+			want:   `{"gpu":{"dvfs":{"min":100}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := parseTestProfile(t, test.parent)
+			merged := &Profile{}
+			mergeProfile(merged, parent)
+			mergeProfile(merged, parseTestProfile(t, test.child))
+			if got, want := profileJSON(t, merged), profileJSON(t, parseTestProfile(t, test.want)); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := profileJSON(t, parent), profileJSON(t, parseTestProfile(t, test.parent)); got != want {
+				t.Errorf("parent was modified to %s", got)
+			}
+		})
+	}
+}
+
+func TestUnsetValue(t *testing.T) {
+	const profile = `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"governors":{"interactive":{"io_is_busy":false}}}}},"cpusets":{"top-app":{"cpus":"0-7"}}}`
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"clusters/apollo/cpufreq/max", `{"clusters":{"apollo":{"cpufreq":{"governors":{"interactive":{"io_is_busy":false}}}}},"cpusets":{"top-app":{"cpus":"0-7"}}}`},
+		{"clusters/apollo/cpufreq/governors/interactive", `{"clusters":{"apollo":{"cpufreq":{"max":1600000}}},"cpusets":{"top-app":{"cpus":"0-7"}}}`},
+		{"clusters/apollo", `{"cpusets":{"top-app":{"cpus":"0-7"}}}`},
+		{"cpusets", `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"governors":{"interactive":{"io_is_busy":false}}}}}}`},
+		{"CPUSets/top-app/CPUs", `{"clusters":{"apollo":{"cpufreq":{"max":1600000,"governors":{"interactive":{"io_is_busy":false}}}}},"cpusets":{"top-app":{}}}`},
+		//Paths that aren't there are left alone
+		{"clusters/atlas/cpufreq/max", profile},
+		{"gpu/dvfs/max", profile},
+		{"nothing", profile},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got := parseTestProfile(t, profile)
+			unsetValue(reflect.ValueOf(got).Elem(), strings.Split(test.path, "/"))
+			if got, want := profileJSON(t, got), profileJSON(t, parseTestProfile(t, test.want)); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
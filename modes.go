@@ -0,0 +1,146 @@
+package main
+
+import "C"
+
+import (
+	"fmt"
+)
+
+//export PowerPulse_SetMode
+func PowerPulse_SetMode(mode int32, enabled bool) {
+	go setMode(mode, enabled, "hal")
+}
+//export PowerPulse_SetModeSync
+func PowerPulse_SetModeSync(mode int32, enabled bool) int32 {
+	return setStatus(setMode(mode, enabled, "hal"))
+}
+func setMode(mode int32, enabled bool, source string) error {
+	if err := initialize(); err != nil {
+		return err
+	}
+	//Profiles changed by a mode are reported as coming from the mode, not from whoever sent it
+	modeSource := "mode:" + PowerMode(mode).String()
+	if PowerMode(mode) != MODE_INTERACTIVE {
+		if action := currentDevice().GetHintAction("MODE:" + PowerMode(mode).String(), PowerMode(mode).String()); action != nil {
+			Debug("Mode: %s: %t (%s)", PowerMode(mode), enabled, action.Action)
+			return doHintAction(action, enabled, modeSource)
+		}
+	}
+	Debug("Mode: %s: %t", PowerMode(mode), enabled)
+	switch PowerMode(mode) {
+	case MODE_INTERACTIVE:
+		return setInteractive(enabled, source)
+
+	case MODE_LOW_POWER:
+		return toggleProfile("battery_saver", enabled, modeSource)
+
+	case MODE_DISPLAY_INACTIVE:
+		return toggleProfile("screen_off", enabled, modeSource)
+
+	case MODE_DEVICE_IDLE:
+		//Doze only starts once the display is inactive, when screen_off is already on, so there's nothing more to do without a mapping
+		return fmt.Errorf("%w: power mode %s without a hint mapping", ErrUnsupported, PowerMode(mode))
+
+	case MODE_LAUNCH, MODE_GAME_LOADING:
+		if enabled {
+			boost(3000000, modeSource) //3 seconds
+		}
+		return nil
+
+	case MODE_SUSTAINED_PERFORMANCE, MODE_FIXED_PERFORMANCE, MODE_VR,
+		MODE_EXPENSIVE_RENDERING, MODE_AUDIO_STREAMING_LOW_LATENCY,
+		MODE_CAMERA_STREAMING_SECURE, MODE_CAMERA_STREAMING_LOW,
+		MODE_CAMERA_STREAMING_MID, MODE_CAMERA_STREAMING_HIGH, MODE_GAME:
+		return toggleProfile("performance", enabled, modeSource)
+	}
+
+	return fmt.Errorf("%w: power mode %s", ErrUnsupported, PowerMode(mode))
+}
+
+//export PowerPulse_IsModeSupported
+func PowerPulse_IsModeSupported(mode int32) bool {
+	if err := initialize(); err != nil {
+		return false
+	}
+	dev := currentDevice()
+	if PowerMode(mode) != MODE_INTERACTIVE {
+		if action := dev.GetHintAction("MODE:" + PowerMode(mode).String(), PowerMode(mode).String()); action != nil {
+			return action.Action != HINT_ACTION_IGNORE
+		}
+	}
+	switch PowerMode(mode) {
+	case MODE_INTERACTIVE, MODE_LAUNCH, MODE_GAME_LOADING:
+		return true
+
+	case MODE_LOW_POWER:
+		return dev.HasProfile("battery_saver")
+
+	case MODE_DISPLAY_INACTIVE:
+		return dev.HasProfile("screen_off")
+
+	case MODE_SUSTAINED_PERFORMANCE, MODE_FIXED_PERFORMANCE, MODE_VR,
+		MODE_EXPENSIVE_RENDERING, MODE_AUDIO_STREAMING_LOW_LATENCY,
+		MODE_CAMERA_STREAMING_SECURE, MODE_CAMERA_STREAMING_LOW,
+		MODE_CAMERA_STREAMING_MID, MODE_CAMERA_STREAMING_HIGH, MODE_GAME:
+		return dev.HasProfile("performance")
+	}
+	return false
+}
+
+//A duration of 0 or less boosts for the governor's configured boostpulse_duration
+//export PowerPulse_SetBoost
+func PowerPulse_SetBoost(boost, durationMs int32) {
+	go setBoost(boost, durationMs, "hal")
+}
+//export PowerPulse_SetBoostSync
+func PowerPulse_SetBoostSync(boost, durationMs int32) int32 {
+	return setStatus(setBoost(boost, durationMs, "hal"))
+}
+func setBoost(powerBoost, durationMs int32, source string) error {
+	if err := initialize(); err != nil {
+		return err
+	}
+	//Profiles changed by a boost are reported as coming from the boost, not from whoever sent it
+	boostSource := "boost:" + PowerBoost(powerBoost).String()
+	if durationMs < 0 {
+		durationMs = 0
+	}
+	if action := currentDevice().GetHintAction("BOOST:" + PowerBoost(powerBoost).String(), PowerBoost(powerBoost).String()); action != nil {
+		Debug("Boost: %s: %dms (%s)", PowerBoost(powerBoost), durationMs, action.Action)
+		return doBoostAction(action, durationMs, boostSource)
+	}
+	Debug("Boost: %s: %dms", PowerBoost(powerBoost), durationMs)
+	switch PowerBoost(powerBoost) {
+	case BOOST_DISPLAY_UPDATE_IMMINENT:
+		if durationMs == 0 {
+			boost(16666, boostSource) //1 frame @60Hz
+			return nil
+		}
+		boost(durationMs * 1000, boostSource)
+		return nil
+
+	case BOOST_INTERACTION, BOOST_ML_ACC, BOOST_AUDIO_LAUNCH,
+		BOOST_CAMERA_LAUNCH, BOOST_CAMERA_SHOT:
+		boost(durationMs * 1000, boostSource)
+		return nil
+	}
+
+	return fmt.Errorf("%w: power boost %s", ErrUnsupported, PowerBoost(powerBoost))
+}
+
+//export PowerPulse_IsBoostSupported
+func PowerPulse_IsBoostSupported(powerBoost int32) bool {
+	if err := initialize(); err != nil {
+		return false
+	}
+	if _, exists := powerBoostNames[PowerBoost(powerBoost)]; !exists {
+		return false
+	}
+	if action := currentDevice().GetHintAction("BOOST:" + PowerBoost(powerBoost).String(), PowerBoost(powerBoost).String()); action != nil {
+		return action.Action != HINT_ACTION_IGNORE
+	}
+	//Without a mapping, boosts need a governor that can boostpulse
+	lock.Lock()
+	defer lock.Unlock()
+	return device.CanBoost()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Default priorities, where higher priority overlays compose on top of lower ones
+//Thermal caps aren't an overlay profile, they're applied on top of whatever the overlays compose
+const (
+	OVERLAY_PRIORITY_HINT          = 10 //Settings merged on top of the base profile by hint overlays
+	OVERLAY_PRIORITY_PROFILE       = 20 //Whole profiles turned on by hints and modes, such as performance
+	OVERLAY_PRIORITY_BATTERY_SAVER = 30
+	OVERLAY_PRIORITY_SCREEN_OFF    = 40
+)
+
+//A profile layered on top of the user's base profile by whoever turned it on, until they turn it off again
+type Overlay struct {
+	Source   string `json:"source"`   //Who owns the overlay, such as "interactive" or "hint:LOW_POWER"
+	Profile  string `json:"profile"`
+	Priority int    `json:"priority"`
+	Replace  bool   `json:"replace"`  //Replaces everything below it, instead of merging its own settings on top
+}
+
+//Active overlays in the order they were turned on, changed with lock held
+//Status reads them without waiting on lock, so they have their own mutex too
+var (
+	overlays = make([]Overlay, 0)
+	overlaysMutex sync.Mutex
+)
+
+func defaultPriority(profile string) int {
+	switch profile {
+	case "screen_off":
+		return OVERLAY_PRIORITY_SCREEN_OFF
+	case "battery_saver":
+		return OVERLAY_PRIORITY_BATTERY_SAVER
+	}
+	return OVERLAY_PRIORITY_PROFILE
+}
+
+//Turns on an overlay, replacing any other overlay from the same source
+func addOverlay(overlay Overlay) error {
+	return replaceOverlay(overlay.Source, &overlay)
+}
+
+//Turns off the overlay from source, leaving any others alone
+func removeOverlay(source string) error {
+	return replaceOverlay(source, nil)
+}
+
+//Turns off the overlay from old and turns on overlay, if there is one, with a single apply
+//An overlay that's already on keeps its place, and nothing is applied if nothing changed
+func replaceOverlay(old string, overlay *Overlay) error {
+	lock.Lock()
+	defer lock.Unlock()
+	overlaysMutex.Lock()
+	active := make([]Overlay, 0, len(overlays) + 1)
+	changed, found := false, false
+	for _, other := range overlays {
+		if overlay != nil && other == *overlay {
+			found = true
+			active = append(active, other)
+			continue
+		}
+		if other.Source == old || (overlay != nil && other.Source == overlay.Source) {
+			Debug("Turning off %s overlay for %s", other.Profile, other.Source)
+			changed = true
+			continue
+		}
+		active = append(active, other)
+	}
+	source := old
+	if overlay != nil {
+		source = overlay.Source
+		if !found {
+			Debug("Turning on %s overlay for %s at priority %d", overlay.Profile, overlay.Source, overlay.Priority)
+			active = append(active, *overlay)
+			changed = true
+		}
+	}
+	if !changed {
+		overlaysMutex.Unlock()
+		return nil
+	}
+	overlays = active
+	overlaysMutex.Unlock()
+	return applyOverlays(source)
+}
+
+//Returns the active overlays from lowest to highest priority, ties in the order they were turned on
+func sortedOverlays() []Overlay {
+	overlaysMutex.Lock()
+	defer overlaysMutex.Unlock()
+	sorted := make([]Overlay, 0, len(overlays))
+	for _, overlay := range overlays {
+		if device.HasProfile(overlay.Profile) {
+			sorted = append(sorted, overlay)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+	return sorted
+}
+
+//Returns the profile to resolve, being base or the highest replacing overlay, and the profiles to merge on top of it
+func composeOverlays(base string) (string, []string) {
+	sorted := sortedOverlays()
+	start := 0
+	for i, overlay := range sorted {
+		if overlay.Replace {
+			base = overlay.Profile
+			start = i + 1
+		}
+	}
+	merged := make([]string, 0, len(sorted) - start)
+	for _, overlay := range sorted[start:] {
+		merged = append(merged, overlay.Profile)
+	}
+	return base, merged
+}
+
+//Reapplies the base profile with the active overlays, must be called with lock held
+func applyOverlays(source string) error {
+	if profileNow == "" {
+		return nil
+	}
+	if bootLocked {
+		//Picked up when the boot lease ends
+		Info("Deferring profile %s until the boot profile is released", profileNow)
+		return fmt.Errorf("%w: deferring %s until boot profile %s is released", ErrLocked, profileNow, device.ProfileBoot)
+	}
+	profile, merged := composeOverlays(profileNow)
+	if err := device.SetProfileOverlays(profile, merged); err != nil {
+		Error("Error applying profile %s: %v", profileNow, err)
+		publish(Event{Type: EventApplyFailed, Source: source, Profile: profileNow, Error: err.Error()})
+		return err
+	}
+	publish(Event{Type: EventProfileApplied, Source: source, Profile: profileNow, Detail: device.AppliedName()})
+	return nil
+}
+
+//Returns the active overlays from lowest to highest priority for status, safe to call without lock
+func activeOverlays() []Overlay {
+	return sortedOverlays()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComposeOverlays(t *testing.T) {
+	tests := []struct {
+		name     string
+		overlays []Overlay //In the order they were turned on
+		base     string
+		merged   []string
+	}{
+		{name: "no overlays", base: "balanced", merged: []string{}},
+		{
+			name: "merged in priority order",
+			overlays: []Overlay{
+				{Source: "hint:SUSTAINED_PERFORMANCE", Profile: "performance", Priority: OVERLAY_PRIORITY_PROFILE},
+				{Source: "hint:CAMERA_STREAMING", Profile: "camera", Priority: OVERLAY_PRIORITY_HINT},
+			},
+			base:   "balanced",
+			merged: []string{"camera", "performance"},
+		},
+		{
+			name: "ties keep the order they were turned on",
+			overlays: []Overlay{
+				{Source: "hint:a", Profile: "performance", Priority: OVERLAY_PRIORITY_HINT},
+				{Source: "hint:b", Profile: "camera", Priority: OVERLAY_PRIORITY_HINT},
+			},
+			base:   "balanced",
+			merged: []string{"performance", "camera"},
+		},
+		{
+			name: "highest replacing overlay becomes the base",
+			overlays: []Overlay{
+				{Source: "interactive", Profile: "screen_off", Priority: OVERLAY_PRIORITY_SCREEN_OFF, Replace: true},
+				{Source: "mode:GAME", Profile: "performance", Priority: OVERLAY_PRIORITY_PROFILE, Replace: true},
+			},
+			base:   "screen_off",
+			merged: []string{},
+		},
+		{
+			name: "only overlays above the replacing one are merged",
+			overlays: []Overlay{
+				{Source: "hint:CAMERA_STREAMING", Profile: "camera", Priority: OVERLAY_PRIORITY_HINT},
+				{Source: "mode:LOW_POWER", Profile: "battery_saver", Priority: OVERLAY_PRIORITY_BATTERY_SAVER, Replace: true},
+				{Source: "hint:INTERACTION", Profile: "performance", Priority: 35},
+			},
+			base:   "battery_saver",
+			merged: []string{"performance"},
+		},
+		{
+			name: "overlays of profiles that no longer exist are skipped",
+			overlays: []Overlay{
+				{Source: "app:example", Profile: "removed", Priority: OVERLAY_PRIORITY_SCREEN_OFF, Replace: true},
+				{Source: "hint:CAMERA_STREAMING", Profile: "camera", Priority: OVERLAY_PRIORITY_HINT},
+			},
+			base:   "balanced",
+			merged: []string{"camera"},
+		},
+	}
+
+	deviceWas, overlaysWere := device, overlays
+	defer func() { device, overlays = deviceWas, overlaysWere }()
+	device = &Device{Profiles: map[string]*Profile{
+		"balanced": {}, "performance": {}, "camera": {}, "battery_saver": {}, "screen_off": {},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overlays = append([]Overlay{}, test.overlays...)
+			base, merged := composeOverlays("balanced")
+			if base != test.base || !reflect.DeepEqual(merged, test.merged) {
+				t.Errorf("got %s with %v, want %s with %v", base, merged, test.base, test.merged)
+			}
+		})
+	}
+}
+
+func TestDefaultPriority(t *testing.T) {
+	//Screen off wins over battery saver, which wins over anything else turned on by a hint or mode
+	if !(defaultPriority("screen_off") > defaultPriority("battery_saver") && defaultPriority("battery_saver") > defaultPriority("performance")) {
+		t.Errorf("got screen_off %d, battery_saver %d and performance %d", defaultPriority("screen_off"), defaultPriority("battery_saver"), defaultPriority("performance"))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 )
 
 type Paths struct {
@@ -16,6 +17,8 @@ type Paths struct {
 	InputBooster *PathsInputBooster
 	SecSlow *PathsSecSlow
 	Inputs map[string]PathsInput
+	PowerSupply string `json:"power_supply"` //universal7420: /sys/class/power_supply
+	Thermal string `json:"thermal"` //universal7420: /sys/class/thermal
 }
 
 type PathsPowerPulse struct {
@@ -34,6 +37,9 @@ type PathsCPUFreq struct {
 	Max string //universal7420: scaling_max_freq
 	Min string //universal7420: scaling_min_freq
 	Speed string //universal7420: scaling_setspeed
+	InfoMax string //universal7420: cpuinfo_max_freq
+	InfoMin string //universal7420: cpuinfo_min_freq
+	Frequencies string //universal7420: scaling_available_frequencies
 	Stats *PathsCPUFreqStats
 }
 
@@ -51,6 +57,7 @@ type PathsCpusets struct {
 type PathsCpuset struct {
 	CPUs string //universal7420: cpus
 	CPUExclusive string //universal7420: cpu_exclusive
+	Tasks string //universal7420: tasks
 }
 
 type PathsIPA struct {
@@ -68,6 +75,8 @@ type PathsGPU struct {
 type PathsGPUDVFS struct {
 	Max string //universal7420: dvfs_max_lock
 	Min string //universal7420: dvfs_min_lock
+	Table string //universal7420: dvfs_table
+	Unit string //universal7420: mhz, the unit of the values above (hz, khz or mhz)
 }
 
 type PathsGPUHighspeed struct {
@@ -138,6 +147,9 @@ func (p *Paths) Init() error {
 					freq.Max, _ = GetPaths_CPUFreq_Max(freqPath)
 					freq.Min, _ = GetPaths_CPUFreq_Min(freqPath)
 					freq.Speed, _ = GetPaths_CPUFreq_Speed(freqPath)
+					freq.InfoMax, _ = GetPaths_CPUFreq_InfoMax(freqPath)
+					freq.InfoMin, _ = GetPaths_CPUFreq_InfoMin(freqPath)
+					freq.Frequencies, _ = GetPaths_CPUFreq_Frequencies(freqPath)
 				}
 			} else {
 				freqPath, err := pathOrStockMustExist(&freq.Path, GetPaths_CPUFreq, cluster.Path)
@@ -160,6 +172,15 @@ func (p *Paths) Init() error {
 				if err := pathMustOrStockCanExist(&freq.Speed, GetPaths_CPUFreq_Speed, freqPath); err != nil {
 					return pathErrorInvalid(freq.Speed, "clusters/%s/cpufreq/speed", clusterName)
 				}
+				if err := pathMustOrStockCanExist(&freq.InfoMax, GetPaths_CPUFreq_InfoMax, freqPath); err != nil {
+					return pathErrorInvalid(freq.InfoMax, "clusters/%s/cpufreq/infomax", clusterName)
+				}
+				if err := pathMustOrStockCanExist(&freq.InfoMin, GetPaths_CPUFreq_InfoMin, freqPath); err != nil {
+					return pathErrorInvalid(freq.InfoMin, "clusters/%s/cpufreq/infomin", clusterName)
+				}
+				if err := pathMustOrStockCanExist(&freq.Frequencies, GetPaths_CPUFreq_Frequencies, freqPath); err != nil {
+					return pathErrorInvalid(freq.Frequencies, "clusters/%s/cpufreq/frequencies", clusterName)
+				}
 			}
 			if freq.Stats == nil {
 				stats := &PathsCPUFreqStats{}
@@ -206,6 +227,7 @@ func (p *Paths) Init() error {
 					cpusetPath := PathsCpuset{}
 					cpusetPath.CPUs, _ = GetPaths_Cpusets_CPUs(cpusetsPath)
 					cpusetPath.CPUExclusive, _ = GetPaths_Cpusets_CPUExclusive(cpusetsPath)
+					cpusetPath.Tasks, _ = GetPaths_Cpusets_Tasks(cpusetsPath)
 					cpusets.Sets[set.Name()] = cpusetPath
 				}
 			}
@@ -226,6 +248,9 @@ func (p *Paths) Init() error {
 			if err := pathMustOrStockCanExist(&cpusetPath.CPUExclusive, GetPaths_Cpusets_CPUExclusive, setPath); err != nil {
 				return pathErrorInvalid(cpusetPath.CPUExclusive, "cpusets/" + cpusetName + "/cpu_exclusive")
 			}
+			if err := pathMustOrStockCanExist(&cpusetPath.Tasks, GetPaths_Cpusets_Tasks, setPath); err != nil {
+				return pathErrorInvalid(cpusetPath.Tasks, "cpusets/" + cpusetName + "/tasks")
+			}
 			cpusets.Sets[cpusetName] = cpusetPath
 		}
 		p.Cpusets = cpusets
@@ -263,6 +288,7 @@ func (p *Paths) Init() error {
 			dvfs := &PathsGPUDVFS{}
 			if err := pathMustOrStockCanExist(&dvfs.Max, GetPaths_GPU_DVFS_Max, gpuPath); err == nil {
 				if err := pathMustOrStockCanExist(&dvfs.Min, GetPaths_GPU_DVFS_Min, gpuPath); err == nil {
+					dvfs.Table, _ = GetPaths_GPU_DVFS_Table(gpuPath)
 					gpu.DVFS = dvfs
 				}
 			}
@@ -292,6 +318,9 @@ func (p *Paths) Init() error {
 			if err := pathMustOrStockCanExist(&dvfs.Min, GetPaths_GPU_DVFS_Min, gpuPath); err != nil {
 				return pathErrorInvalid(dvfs.Min, "gpu/dvfs/min")
 			}
+			if err := pathMustOrStockCanExist(&dvfs.Table, GetPaths_GPU_DVFS_Table, gpuPath); err != nil {
+				return pathErrorInvalid(dvfs.Table, "gpu/dvfs/table")
+			}
 		}
 
 		if gpu.Highspeed != nil {
@@ -458,9 +487,89 @@ func (p *Paths) Init() error {
 		}
 	}
 
+	if p.PowerSupply == "" {
+		pathStockCanExist(&p.PowerSupply, GetPaths_PowerSupply)
+	} else if !pathValid(p.PowerSupply) {
+		return pathErrorInvalid(p.PowerSupply, "power_supply")
+	}
+	if p.Thermal == "" {
+		pathStockCanExist(&p.Thermal, GetPaths_Thermal)
+	} else if !pathValid(p.Thermal) {
+		return pathErrorInvalid(p.Thermal, "thermal")
+	}
+
 	return nil
 }
 
+//Lists the subsystems that were discovered or defined, named after their manifest paths
+func (p *Paths) Subsystems() []string {
+	subsystems := make([]string, 0)
+	if p.PowerPulse != nil && p.PowerPulse.Profile != "" {
+		subsystems = append(subsystems, "powerpulse/profile")
+	}
+	clusterNames := make([]string, 0, len(p.Clusters))
+	for clusterName := range p.Clusters {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Strings(clusterNames)
+	for _, clusterName := range clusterNames {
+		if p.Clusters[clusterName].CPUFreq != nil && p.Clusters[clusterName].CPUFreq.Path != "" {
+			subsystems = append(subsystems, "clusters/" + clusterName + "/cpufreq")
+		} else {
+			subsystems = append(subsystems, "clusters/" + clusterName)
+		}
+	}
+	if p.Cpusets != nil && p.Cpusets.Path != "" {
+		subsystems = append(subsystems, "cpusets")
+	}
+	if p.IPA != nil && p.IPA.Path != "" {
+		subsystems = append(subsystems, "ipa")
+	}
+	if p.GPU != nil && p.GPU.Path != "" {
+		if p.GPU.DVFS != nil {
+			subsystems = append(subsystems, "gpu/dvfs")
+		}
+		if p.GPU.Highspeed != nil {
+			subsystems = append(subsystems, "gpu/highspeed")
+		}
+		if p.GPU.DVFS == nil && p.GPU.Highspeed == nil {
+			subsystems = append(subsystems, "gpu")
+		}
+	}
+	if p.Kernel != nil {
+		if p.Kernel.DynamicHotplug != "" {
+			subsystems = append(subsystems, "kernel/dynamic_hotplug")
+		}
+		if p.Kernel.PowerEfficient != "" {
+			subsystems = append(subsystems, "kernel/power_efficient")
+		}
+		if p.Kernel.HMP != nil && p.Kernel.HMP.Path != "" {
+			subsystems = append(subsystems, "kernel/hmp")
+		}
+	}
+	if p.InputBooster != nil && p.InputBooster.Path != "" {
+		subsystems = append(subsystems, "input_booster")
+	}
+	if p.SecSlow != nil && p.SecSlow.Path != "" {
+		subsystems = append(subsystems, "sec_slow")
+	}
+	inputNames := make([]string, 0, len(p.Inputs))
+	for inputName := range p.Inputs {
+		inputNames = append(inputNames, inputName)
+	}
+	sort.Strings(inputNames)
+	for _, inputName := range inputNames {
+		subsystems = append(subsystems, "inputs/" + inputName)
+	}
+	if p.PowerSupply != "" {
+		subsystems = append(subsystems, "power_supply")
+	}
+	if p.Thermal != "" {
+		subsystems = append(subsystems, "thermal")
+	}
+	return subsystems
+}
+
 func pathErrorDefinition(nameFormat string, formats ...any) error {
 	name := fmt.Sprintf(nameFormat, formats...)
 	return fmt.Errorf("please define path for %s, or remove it from manifest", name)
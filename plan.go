@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+type PlannedWrite struct {
+	Step    int    //Which sync the write belongs to, as cpusets are synced in several steps
+	Path    string
+	Current string
+	Data    string
+	Missing bool
+}
+
+//Records what SyncProfile would write in place of writing it
+func (dev *Device) planBuffered() {
+	if len(dev.Buffered) == 0 {
+		return
+	}
+	dev.PlanStep++
+	for i := 0; i < len(dev.Buffered); i++ {
+		bw := dev.Buffered[i]
+		pw := PlannedWrite{Step: dev.PlanStep, Path: bw.Path, Data: bw.Data}
+		buffer, err := ioutil.ReadFile(bw.Path)
+		if err != nil {
+			pw.Missing = os.IsNotExist(err)
+			if !pw.Missing {
+				pw.Current = fmt.Sprintf("(unreadable: %v)", err)
+			}
+		} else {
+			if len(buffer) > 0 && buffer[len(buffer)-1] == '\n' { buffer = buffer[:len(buffer)-1] }
+			pw.Current = string(buffer)
+		}
+		dev.Planned = append(dev.Planned, pw)
+	}
+}
+
+//Prints the planned writes and returns how many of them target missing paths
+func (dev *Device) PrintPlan(name string) int {
+	fmt.Printf("Plan for %s:\n", name)
+	step := 0
+	changes, missing := 0, 0
+	for _, pw := range dev.Planned {
+		if pw.Step != step {
+			step = pw.Step
+			fmt.Printf("Step %d:\n", step)
+		}
+		data := pw.Data
+		if data == "-" {
+			data = "(cleared)"
+		}
+		switch {
+		case pw.Missing:
+			missing++
+			fmt.Printf("  MISSING   %s: %s\n", pw.Path, data)
+		case pw.Current == pw.Data:
+			fmt.Printf("  unchanged %s: %s\n", pw.Path, data)
+		default:
+			changes++
+			fmt.Printf("  write     %s: %s -> %s\n", pw.Path, pw.Current, data)
+		}
+	}
+	fmt.Printf("%d writes, %d changes, %d missing paths\n", len(dev.Planned), changes, missing)
+	return missing
+}
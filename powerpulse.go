@@ -3,7 +3,11 @@ package main
 import (
 	"C"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +17,7 @@ import (
 
 var (
 	lock sync.Mutex
+	initMutex sync.Mutex
 
 	device *Device = nil
 	manifests = []string{
@@ -27,8 +32,11 @@ var (
 	profileLast = ""
 	debug = true
 	verbose = true
+	quiet = false //Drops everything short of fatal, for commands that print their own output
 	booted = false
 	bootedProfile = false
+	bootLocked = false
+	dryRun = false
 )
 
 //export PowerPulse_Stargaze
@@ -54,89 +62,122 @@ func stargaze() {
 
 //export PowerPulse_SetProfile
 func PowerPulse_SetProfile(profile *C.char) {
-	go setProfile(C.GoString(profile))
+	go setProfile(C.GoString(profile), "hal")
 }
-func setProfile(profile string) {
-	PowerPulse_Init()
-	if device == nil {
-		return
+//export PowerPulse_SetProfileSync
+func PowerPulse_SetProfileSync(profile *C.char) int32 {
+	return setStatus(setProfile(C.GoString(profile), "hal"))
+}
+func setProfile(profile, source string) error {
+	if err := initialize(); err != nil {
+		return err
 	}
 	lock.Lock()
 	defer lock.Unlock()
 	Debug("Got past lock for setProfile(%s)", profile)
 
-	//When device.SetProfile is called but device.ProfileLock is true, profileNow is still updated with the new request
-	profileLast = profileNow
-
 	if !bootedProfile && device.ProfileBoot != "" && device.ProfileBootDuration.String() != "" {
 		Debug("Applying boot profile %s", device.ProfileBoot)
 		duration, err := device.ProfileBootDuration.Int64()
 		if err != nil {
 			Error("Error applying boot profile %s for duration %s: %v", device.ProfileBoot, device.ProfileBootDuration, err)
-			return
+			return fmt.Errorf("invalid boot profile duration %s: %v", device.ProfileBootDuration, err)
 		}
 		if err := device.SetProfile(device.ProfileBoot); err != nil {
 			Error("Error applying boot profile %s: %v", device.ProfileBoot, err)
-			return
+			publish(Event{Type: EventApplyFailed, Source: "boot", Profile: device.ProfileBoot, Error: err.Error()})
+			return err
 		}
+		publish(Event{Type: EventProfileApplied, Source: "boot", Profile: device.ProfileBoot})
 		bootedProfile = true
 		if profile == "" {
-			PowerPulse_Stargaze()
+			stargaze()
 			profile = profileNow
 		}
 		if duration > 0 {
-			device.ProfileLock = true
 			Debug("Deferring profile %s for %d seconds", profile, duration)
-			time.Sleep(time.Second * time.Duration(duration))
-			device.ProfileLock = false
+			startBootLease(time.Second * time.Duration(duration))
 		}
 	}
 
-	//Check if we need to change course on which profile to apply
-	if profileNow != profileLast {
-		profile = profileNow
+	if !device.HasProfile(profile) {
+		err := fmt.Errorf("%w: %s", ErrNoProfile, profile)
+		Error("Error applying profile %s: %v", profile, err)
+		publish(Event{Type: EventApplyFailed, Source: source, Profile: profile, Error: err.Error()})
+		return err
+	}
+
+	//Only the base profile changes here, overlays stay on until whoever turned them on turns them off
+	//The base is recorded even if we're locked out, so it's applied once the lock is released
+	nowWas, lastWas := profileNow, profileLast
+	if profile != profileNow {
+		profileLast = profileNow
+		profileNow = profile
 	}
 
-	Info("Applying profile %s", profile)
-	if err := device.SetProfile(profile); err != nil {
-		Error("Error applying profile %s: %v", profile, err)
-		return
+	if !bootLocked {
+		Info("Applying profile %s", profile)
 	}
-	profileNow = profile
+	err := applyOverlays(source)
+	if err != nil && !errors.Is(err, ErrLocked) {
+		profileNow, profileLast = nowWas, lastWas
+		return err
+	}
+	//A deferred profile is still what the user asked for
 	if err := device.CacheProfile(profile); err != nil {
 		Warn("Failed to cache profile %s for reboot: %v", profile, err)
 	}
+	return err
 }
 
 //export PowerPulse_ResetProfile
 func PowerPulse_ResetProfile() {
-	go resetProfile()
+	go resetProfile("hal")
 }
-func resetProfile() {
-	PowerPulse_Init()
-	if device == nil {
-		return
+//export PowerPulse_ResetProfileSync
+func PowerPulse_ResetProfileSync() int32 {
+	return setStatus(resetProfile("hal"))
+}
+func resetProfile(source string) error {
+	if err := initialize(); err != nil {
+		return err
 	}
 	lock.Lock()
 	defer lock.Unlock()
 	Debug("Got past lock for resetProfile()")
 
 	if profileLast != "" {
-		if err := device.SetProfile(profileLast); err != nil {
-			Error("Error resetting to profile %s: %v", profileLast, err)
-			return
+		Info("Resetting to profile %s", profileLast)
+		profileNow, profileLast = profileLast, profileNow
+		if err := applyOverlays(source); err != nil {
+			if !errors.Is(err, ErrLocked) {
+				profileNow, profileLast = profileLast, profileNow
+			}
+			return err
 		}
-		profileTmp := profileNow
-		profileNow = profileLast
-		profileLast = profileTmp
 	}
+	return nil
 }
 
 //export PowerPulse_SetInteractive
 func PowerPulse_SetInteractive(interactive bool) {
-	go setInteractive(interactive)
+	go setInteractive(interactive, "hal")
 }
-func setInteractive(interactive bool) {
+//export PowerPulse_SetInteractiveSync
+func PowerPulse_SetInteractiveSync(interactive bool) int32 {
+	return setStatus(setInteractive(interactive, "hal"))
+}
+func setInteractive(interactive bool, source string) error {
+	if err := initialize(); err != nil {
+		return err
+	}
+	if interactive {
+		publish(Event{Type: EventInteractive, Source: source, Detail: "on"})
+	} else {
+		publish(Event{Type: EventInteractive, Source: source, Detail: "off"})
+	}
+
+	lock.Lock()
 	for inputName, input := range device.Paths.Inputs {
 		if input.Path != "" {
 			switch input.Type {
@@ -154,102 +195,107 @@ func setInteractive(interactive bool) {
 			}
 		}
 	}
+	lock.Unlock()
 
-	if profile := device.GetProfile("screen_off"); profile != nil {
-		if interactive {
-			Debug("Turning off screen off profile")
-			resetProfile()
-		} else {
-			Debug("Turning on screen off profile")
-			setProfile("screen_off")
-		}
-	}
+	return toggleProfile("screen_off", !interactive, "interactive")
 }
 
 //export PowerPulse_SetPowerHint
 func PowerPulse_SetPowerHint(hint, data int32) {
-	go setPowerHint(hint, data)
+	go setPowerHint(hint, data, "hal")
 }
-func setPowerHint(hint, data int32) {
+//export PowerPulse_SetPowerHintSync
+func PowerPulse_SetPowerHintSync(hint, data int32) int32 {
+	return setStatus(setPowerHint(hint, data, "hal"))
+}
+func setPowerHint(hint, data int32, source string) error {
+	if err := initialize(); err != nil {
+		return err
+	}
+	//Profiles changed by a hint are reported as coming from the hint, not from whoever sent it
+	hintSource := "hint:" + PowerHint(hint).String()
+	dev := currentDevice()
+	if PowerHint(hint) != HINT_LINEAGE_SET_PROFILE {
+		if action := dev.GetHintAction("HINT:" + PowerHint(hint).String(), PowerHint(hint).String()); action != nil {
+			Debug("PowerHint: %s: %d (%s)", PowerHint(hint), data, action.Action)
+			return doHintAction(action, data > 0, hintSource)
+		}
+	}
 	switch PowerHint(hint) {
 	case HINT_VSYNC:
 		if data > 0 {
 			Debug("PowerHint: VSYNC: on")
 			//TODO: device.Boosting = true; go device.BoostIf()
-			device.Boost(16666) //1 frame @60Hz
+			boost(16666, hintSource) //1 frame @60Hz
 		} else {
 			Debug("PowerHint: VSYNC: off")
 			//TODO: device.Boosting = false
 		}
-		return
+		return nil
 
 	case HINT_INTERACTION:
-		device.Boost(data * 1000)
-		return
+		boost(data * 1000, hintSource)
+		return nil
 
 	case HINT_VIDEO_ENCODE:
 		Debug("PowerHint: DEPRECATED: VIDEO_ENCODE: %d", data)
-		return
+		return nil
 
 	case HINT_VIDEO_DECODE:
 		Debug("PowerHint: DEPRECATED: VIDEO_DECODE: %d", data)
-		return
+		return nil
 
 	case HINT_LOW_POWER:
-		if profile := device.GetProfile("battery_saver"); profile != nil {
-			if data > 0 {
-				Debug("Turning on battery saver profile")
-				setProfile("battery_saver")
-			} else {
-				Debug("Turning off battery saver profile")
-				resetProfile()
-			}
-		}
-		return
+		return toggleProfile("battery_saver", data > 0, hintSource)
 
 	case HINT_LAUNCH:
 		if data > 0 {
 			//TODO: device.Boosting = true; go device.BoostIf()
-			device.Boost(3000000) //3 seconds
+			boost(3000000, hintSource) //3 seconds
 		} else {
 			//TODO: device.Boosting = false
 		}
-		return
+		return nil
 
 	case HINT_SUSTAINED_PERFORMANCE, HINT_VR_MODE,
 		HINT_AUDIO_STREAMING, HINT_AUDIO_LOW_LATENCY,
 		HINT_CAMERA_LAUNCH, HINT_CAMERA_STREAMING, HINT_CAMERA_SHOT,
 		HINT_EXPENSIVE_RENDERING, HINT_LINEAGE_CPU_BOOST:
-		if profile := device.GetProfile("performance"); profile != nil {
-			if data > 0 {
-				Debug("Turning on performance profile")
-				setProfile("performance")
-			} else {
-				Debug("Turning off performance profile")
-				resetProfile()
-			}
-		}
-		return
+		return toggleProfile("performance", data > 0, hintSource)
 
 	case HINT_LINEAGE_SET_PROFILE:
-		switch data {
-		case -1:
-			setProfile("screen_off")
-		case 0:
-			setProfile("battery_saver")
-		case 3:
-			setProfile("efficiency")
-		case 1:
-			setProfile("balanced")
-		case 4:
-			setProfile("quick")
-		case 2:
-			setProfile("performance")
+		profile, err := dev.LineageProfile(data)
+		if err != nil {
+			return err
 		}
-		return
+		Debug("PowerHint: LINEAGE_SET_PROFILE: %d (%s)", data, profile)
+		return setProfile(profile, source)
 	}
 
 	Debug("PowerHint: %d: %d (not supported)", hint, data)
+	return fmt.Errorf("%w: power hint %s", ErrUnsupported, PowerHint(hint))
+}
+
+//Layers a temporary profile over the base profile while enabled and takes it off when disabled, if the manifest has it
+func toggleProfile(profile string, enabled bool, source string) error {
+	if !currentDevice().HasProfile(profile) {
+		return nil
+	}
+	if enabled {
+		return addOverlay(Overlay{Source: source, Profile: profile, Priority: defaultPriority(profile), Replace: true})
+	}
+	return removeOverlay(source)
+}
+
+//Boosts in microseconds, like Device.Boost
+func boost(durUs int32, source string) {
+	//Boosts go through the applied profile's governors, so hold off profile changes until they're written
+	lock.Lock()
+	boosted := device.Boost(durUs)
+	lock.Unlock()
+	if boosted {
+		publish(Event{Type: EventBoost, Source: source, Detail: fmt.Sprintf("%dμs", durUs)})
+	}
 }
 
 //export PowerPulse_SetFeature
@@ -271,9 +317,12 @@ func PowerPulse_GetFeature(feature int32) uint32 {
 		return 1 //TODO: return from config
 
 	case FEATURE_SUPPORTED_PROFILES:
-		if len(device.ProfileOrder) > 0 {
-			Debug("GetFeature: SUPPORTED_PROFILES: true")
-			return uint32(len(device.ProfileOrder))
+		if err := initialize(); err != nil {
+			return 0
+		}
+		if supported := currentDevice().lineageSupported(); supported > 0 {
+			Debug("GetFeature: SUPPORTED_PROFILES: %d", supported)
+			return uint32(supported)
 		}
 		Debug("GetFeature: SUPPORTED_PROFILES: false")
 		return 0
@@ -287,25 +336,45 @@ func PowerPulse_GetFeature(feature int32) uint32 {
 func PowerPulse_Init() {
 	go initialize()
 }
-func initialize() {
+//export PowerPulse_InitSync
+func PowerPulse_InitSync() int32 {
+	return setStatus(initialize())
+}
+func initialize() error {
+	initMutex.Lock()
+	defer initMutex.Unlock()
 	if booted {
-		return
+		if currentDevice() == nil {
+			return fmt.Errorf("%w: the manifest failed to load, reload it to try again", ErrNotReady)
+		}
+		return nil
 	}
 	booted = true
 	startTime := time.Now()
+	if !dryRun {
+		go runThrottle()
+	}
 
 	Info("Need to boot PowerPulse first, just a blip...")
-	reloadConfig()
+	if err := reloadConfig("init"); err != nil {
+		return err
+	}
 
 	deltaTime := time.Now().Sub(startTime).Milliseconds()
 	Info("PowerPulse finished init in %dms", deltaTime)
+	return nil
 }
 
 //export PowerPulse_ReloadConfig
 func PowerPulse_ReloadConfig() {
-	go reloadConfig()
+	go reloadConfig("hal")
 }
-func reloadConfig() {
+//export PowerPulse_ReloadConfigSync
+func PowerPulse_ReloadConfigSync() int32 {
+	return setStatus(reloadConfig("hal"))
+}
+//The live device is only replaced once the new manifest loads successfully
+func reloadConfig(source string) error {
 	deviceJSON := make([]byte, 0)
 	for i := 0; i < len(manifests); i++ {
 		tmpJSON, err := ioutil.ReadFile(manifests[i])
@@ -315,123 +384,216 @@ func reloadConfig() {
 			break
 		}
 	}
+	if len(deviceJSON) == 0 {
+		Error("Error reading device manifest: No manifest was found")
+		return fmt.Errorf("no manifest was found in %s", manifests)
+	}
 
-	device = &Device{}
-	if err := json.Unmarshal(deviceJSON, device); err != nil {
-		Error("Error parsing manifest: %v", err)
-		return
+	requested := requestedProfile()
+	dev, profile, err := loadManifest(deviceJSON, requested)
+	if err != nil {
+		return err
 	}
 
-	if device.Paths == nil {
-		device.Paths = &Paths{}
+	lock.Lock()
+	//Keep whatever was asked for while we were loading
+	if profileNow == requested {
+		profileNow = profile
 	}
-	if err := device.Paths.Init(); err != nil {
-		Error("Error parsing paths from device manifest: %v", err)
-		return
+	device = dev
+	lock.Unlock()
+	publish(Event{Type: EventConfigReloaded, Source: source})
+	return nil
+}
+
+//Returns the loaded device, safe to call without lock as reloads replace it instead of changing it
+func currentDevice() *Device {
+	lock.Lock()
+	defer lock.Unlock()
+	return device
+}
+
+//Returns the profile the user or framework asked for, safe to call without lock
+func requestedProfile() string {
+	lock.Lock()
+	defer lock.Unlock()
+	return profileNow
+}
+
+//Each part of the manifest beyond the profiles, in the order it's loaded, with what the log calls it
+var manifestSections = []struct {
+	name string
+	init func(*Device) error
+}{
+	{"hints", (*Device).initHints},
+	{"apps", (*Device).initApps},
+	{"sensors", (*Device).initSensors},
+	{"rules", (*Device).initRules},
+	{"throttle", (*Device).initThrottle},
+	{"boot settle", (*Device).initBootSettle},
+	{"write cache", (*Device).initWriteCache},
+}
+
+//Parses and checks a manifest into a new device, logging the first problem found
+//Also returns the profile to start with, being requested or otherwise the boot or cached profile
+func loadManifest(deviceJSON []byte, requested string) (*Device, string, error) {
+	dev, err := parseManifest(deviceJSON)
+	if err != nil {
+		Error("Error reading device manifest: %v", err)
+		return nil, "", err
 	}
 
-	pathsJSON, err := json.Marshal(device.Paths)
+	pathsJSON, err := json.Marshal(dev.Paths)
 	if err != nil {
 		Debug("DEBUG: Error marshalling paths for print: %v", err)
-		return
+	} else {
+		Debug(string(pathsJSON))
 	}
-	Debug(string(pathsJSON))
 
-	if len(device.Profiles) < 1 {
-		Error("Error reading device manifest: No profiles were found")
-		return
+	for _, section := range manifestSections {
+		if err := section.init(dev); err != nil {
+			Error("Error reading %s from device manifest: %v", section.name, err)
+			return nil, "", err
+		}
 	}
 
-	for profileName := range device.Profiles {
+	requested = dev.bootProfile(requested)
+	dev.defaultInheritance(requested)
+	if err := dev.initExtends(); err != nil {
+		Error("Error reading profiles from device manifest: %v", err)
+		return nil, "", err
+	}
+	dev.resolveProfiles()
+	if err := dev.initOrder(requested); err != nil {
+		Debug("No identifiable boot profile, please set your profile order and/or your boot profile!")
+		Error("Error reading device manifest: %v", err)
+		return nil, "", err
+	}
+	if err := dev.initLineage(); err != nil {
+		Error("Error reading lineage profiles from device manifest: %v", err)
+		return nil, "", err
+	}
+
+	return dev, requested, nil
+}
+
+//Decodes the manifest, discovers its paths and normalizes the profile names everything else looks up
+func parseManifest(deviceJSON []byte) (*Device, error) {
+	dev := &Device{}
+	if err := json.Unmarshal(deviceJSON, dev); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	if dev.Paths == nil {
+		dev.Paths = &Paths{}
+	}
+	if err := dev.Paths.Init(); err != nil {
+		return nil, fmt.Errorf("failed to parse paths from manifest: %v", err)
+	}
+
+	if len(dev.Profiles) < 1 {
+		return nil, fmt.Errorf("no profiles were found in manifest")
+	}
+
+	for profileName := range dev.Profiles {
 		adjustedName := strings.ReplaceAll(strings.ToLower(profileName), " ", "_")
 		if adjustedName != profileName {
-			device.Profiles[adjustedName] = device.Profiles[profileName]
-			delete(device.Profiles, profileName)
+			dev.Profiles[adjustedName] = dev.Profiles[profileName]
+			delete(dev.Profiles, profileName)
 			Debug("Found profile %s as %s", profileName, adjustedName)
 		} else {
 			Debug("Found profile %s", adjustedName)
 		}
 	}
 
-	if device.ProfileBoot != "" {
-		device.ProfileBoot = strings.ReplaceAll(strings.ToLower(device.ProfileBoot), " ", "_")
+	if dev.ProfileBoot != "" {
+		dev.ProfileBoot = strings.ReplaceAll(strings.ToLower(dev.ProfileBoot), " ", "_")
 	}
+	return dev, nil
+}
 
-	if profileNow == "" {
-		if device.ProfileBoot != "" {
-			profileNow = strings.ReplaceAll(strings.ToLower(device.ProfileBoot), " ", "_")
-		}
-		if device.Paths.PowerPulse != nil && device.Paths.PowerPulse.Profile != "" {
-			buffer, err := ioutil.ReadFile(device.Paths.PowerPulse.Profile)
-			if err == nil && len(buffer) > 0 {
-				if buffer[len(buffer)-1] == '\n' { buffer = buffer[:len(buffer)-1] }
-				profileNow = strings.ReplaceAll(strings.ToLower(string(buffer)), " ", "_")
-			}
+//Returns the profile to start with, which is the requested one if there is one
+func (dev *Device) bootProfile(requested string) string {
+	if requested != "" {
+		return strings.ReplaceAll(strings.ToLower(requested), " ", "_")
+	}
+	if dev.ProfileBoot != "" {
+		requested = dev.ProfileBoot
+	}
+	if dev.Paths.PowerPulse != nil && dev.Paths.PowerPulse.Profile != "" {
+		buffer, err := ioutil.ReadFile(dev.Paths.PowerPulse.Profile)
+		if err == nil && len(buffer) > 0 {
+			if buffer[len(buffer)-1] == '\n' { buffer = buffer[:len(buffer)-1] }
+			requested = strings.ReplaceAll(strings.ToLower(string(buffer)), " ", "_")
 		}
-	} else {
-		profileNow = strings.ReplaceAll(strings.ToLower(profileNow), " ", "_")
 	}
+	return requested
+}
 
-	if device.ProfileInheritance == nil || len(device.ProfileInheritance) == 0 {
+//Fills in the profile inheritance from the recognizable profiles when the manifest doesn't set it
+func (dev *Device) defaultInheritance(requested string) {
+	if dev.ProfileInheritance == nil || len(dev.ProfileInheritance) == 0 {
 		Debug("No profile inheritance was specified")
 		//Try to add any recognizable profiles
 		pi := make([]string, 0)
 		try := []string{"screen_off", "battery_saver", "efficiency", "balanced", "quick", "performance", "bootpulse"}
 		for i := 0; i < len(try); i++ {
-			if p := device.GetProfile(try[i]); p != nil {
+			if dev.HasProfile(try[i]) {
 				Debug("Found profile %s", try[i])
 				pi = append(pi, try[i])
 			}
 		}
-		if profileNow != "" {
+		if requested != "" {
 			found := false
 			for i := 0; i < len(pi); i++ {
-				if pi[i] == profileNow {
+				if pi[i] == requested {
 					found = true
 					break
 				}
 			}
 			if !found {
 				//Start with the configured boot profile, in case we inherit special settings (better to be safe than sorry!)
-				pi = append([]string{profileNow}, pi...)
+				pi = append([]string{requested}, pi...)
 			}
 		}
-		device.ProfileInheritance = pi
+		dev.ProfileInheritance = pi
 	}
-	Debug("Profile inheritance: %s", device.ProfileInheritance)
+	Debug("Profile inheritance: %s", dev.ProfileInheritance)
+}
 
-	if device.ProfileOrder == nil || len(device.ProfileOrder) == 0 {
+//Fills in the profile order from the recognizable profiles when the manifest doesn't set it
+func (dev *Device) initOrder(requested string) error {
+	if dev.ProfileOrder == nil || len(dev.ProfileOrder) == 0 {
 		Debug("No profile order was specified")
 		//Try to add any recognizable profiles
 		po := make([]string, 0)
 		try := []string{"battery_saver", "efficiency", "balanced", "quick", "performance"}
 		for i := 0; i < len(try); i++ {
-			if p := device.GetProfile(try[i]); p != nil {
+			if dev.HasProfile(try[i]) {
 				Debug("Found profile %s", try[i])
 				po = append(po, try[i])
 			}
 		}
-		if profileNow != "" {
+		if requested != "" {
 			found := false
 			for i := 0; i < len(po); i++ {
-				if po[i] == profileNow {
+				if po[i] == requested {
 					found = true
 					break
 				}
 			}
 			if !found {
 				//Start with the configured boot profile, in case we inherit special settings (better to be safe than sorry!)
-				po = append([]string{profileNow}, po...)
+				po = append([]string{requested}, po...)
 			}
 		}
-		device.ProfileOrder = po
+		dev.ProfileOrder = po
 	}
-	if len(device.ProfileOrder) == 0 {
-		Debug("No identifiable boot profile, please set your profile order and/or your boot profile!")
-		Error("Error reading device manifest!")
-		return
+	if len(dev.ProfileOrder) == 0 {
+		return fmt.Errorf("no profile order was found, set profile_order and/or profile_boot")
 	}
-	Debug("Profile order: %s", device.ProfileOrder)
+	Debug("Profile order: %s", dev.ProfileOrder)
+	return nil
 }
 
 func main() {
@@ -441,11 +603,58 @@ func main() {
 	pflag.StringVarP(&profileNow, "profile", "p", profileNow, "profile override")
 	pflag.BoolVarP(&debug, "debug", "d", debug, "debug mode")
 	pflag.BoolVarP(&verbose, "verbose", "v", verbose, "verbose mode")
+	pflag.BoolVarP(&daemonMode, "daemon", "D", daemonMode, "stay resident and accept commands on the control socket")
+	pflag.StringVarP(&socketPath, "socket", "s", socketPath, "path to the control socket")
+	pflag.BoolVarP(&dryRun, "dry-run", "n", dryRun, "print what applying the profile would write, without writing anything")
+	pflag.CommandLine.SetInterspersed(false)
 	pflag.Parse()
 
-	initialize()
-	stargaze()
+	//Act as the control client when asked to, either as "powerpulse ctl" or through a powerpulsectl symlink
+	if filepath.Base(os.Args[0]) == "powerpulsectl" {
+		os.Exit(ctl(pflag.Args()))
+	}
+	if pflag.NArg() > 0 && pflag.Arg(0) == "ctl" {
+		os.Exit(ctl(pflag.Args()[1:]))
+	}
+	if pflag.NArg() > 0 && pflag.Arg(0) == "validate" {
+		os.Exit(validate(pflag.Args()[1:]))
+	}
 
-	Info("Applying profile %s", profileNow)
-	setProfile(profileNow)
+	if dryRun {
+		if err := initialize(); err != nil {
+			Fatal("Error loading manifest for dry run: %v", err)
+		}
+		if profileNow != "" && !device.HasProfile(profileNow) {
+			Fatal("Error planning profile %s: %v", profileNow, ErrNoProfile)
+		}
+		stargaze()
+		device.DryRun = true
+		if err := device.SetProfileOverlays(profileNow, nil); err != nil {
+			Fatal("Error planning profile %s: %v", profileNow, err)
+		}
+		if missing := device.PrintPlan(profileNow); missing > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := initialize(); err == nil {
+		stargaze()
+
+		Info("Applying profile %s", profileNow)
+		setProfile(profileNow, "cli")
+
+		//Without the daemon nothing is left to apply the deferred profile once we exit
+		if !daemonMode {
+			waitBootReleased()
+		}
+	}
+
+	if daemonMode {
+		go runRules()
+		go runApps()
+		if err := daemon(); err != nil {
+			Fatal("Error running daemon: %v", err)
+		}
+	}
 }
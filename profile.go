@@ -7,81 +7,83 @@ import (
 )
 
 type Profile struct {
-	Clusters map[string]*Cluster
-	CPUSets map[string]*CPUSet
-	GPU *GPU
-	Kernel *Kernel
-	IPA *IPA
-	InputBooster *InputBooster
-	SecSlow *SecSlow
+	Extends []string `json:"extends,omitempty" merge:"-"` //Parent profiles to inherit from in order, in place of profile_inheritance
+	Unset []string `json:"-" merge:"-"` //Paths set to null or "unset", dropped from the parents when merging
+	Clusters map[string]*Cluster `json:",omitempty"`
+	CPUSets map[string]*CPUSet `json:",omitempty"`
+	GPU *GPU `json:",omitempty"`
+	Kernel *Kernel `json:",omitempty"`
+	IPA *IPA `json:",omitempty"`
+	InputBooster *InputBooster `json:",omitempty"`
+	SecSlow *SecSlow `json:",omitempty"`
 }
 
 type Cluster struct {
-	CPUFreq *CPUFreq
+	CPUFreq *CPUFreq `json:",omitempty"`
 }
 
 type CPUFreq struct {
-	Max json.Number
-	Min json.Number
-	Speed json.Number
-	Governor string
-	Governors map[string]map[string]interface{} //"interactive":{"arg":0,"arg2":"val"},"performance":{"arg":true}
+	Max Frequency `json:",omitempty"`
+	Min Frequency `json:",omitempty"`
+	Speed Frequency `json:",omitempty"`
+	Governor string `json:",omitempty"`
+	Governors map[string]map[string]interface{} `json:",omitempty"` //"interactive":{"arg":0,"arg2":"val"},"performance":{"arg":true}
 }
 
 type CPUSet struct {
-	CPUs string
-	CPUExclusive *bool `json:"cpu_exclusive"`
+	CPUs string `json:",omitempty"`
+	CPUExclusive *bool `json:"cpu_exclusive,omitempty"`
 }
 
 type GPU struct {
-	DVFS *DVFS
-	Highspeed *GPUHighspeed
+	DVFS *DVFS `json:",omitempty"`
+	Highspeed *GPUHighspeed `json:",omitempty"`
 }
 
 type DVFS struct {
-	Max json.Number
-	Min json.Number
+	Max Frequency `json:",omitempty"`
+	Min Frequency `json:",omitempty"`
 }
 
 type GPUHighspeed struct {
-	Clock json.Number
-	Load json.Number
+	Clock json.Number `json:",omitempty"`
+	Load json.Number `json:",omitempty"`
 }
 
 type Kernel struct {
-	DynamicHotplug *bool
-	PowerEfficient *bool
-	HMP *KernelHMP
+	DynamicHotplug *bool `json:",omitempty"`
+	PowerEfficient *bool `json:",omitempty"`
+	HMP *KernelHMP `json:",omitempty"`
 }
 
 type KernelHMP struct {
-	Boost *bool
-	Semiboost *bool
-	ActiveDownMigration *bool
-	AggressiveUpMigration *bool
-	Threshold *KernelHMPThreshold
-	SbThreshold *KernelHMPThreshold
+	Boost *bool `json:",omitempty"`
+	Semiboost *bool `json:",omitempty"`
+	ActiveDownMigration *bool `json:",omitempty"`
+	AggressiveUpMigration *bool `json:",omitempty"`
+	Threshold *KernelHMPThreshold `json:",omitempty"`
+	SbThreshold *KernelHMPThreshold `json:",omitempty"`
 }
 
 type KernelHMPThreshold struct {
-	Down json.Number
-	Up json.Number
+	Down json.Number `json:",omitempty"`
+	Up json.Number `json:",omitempty"`
 }
 
 type IPA struct {
-	Enabled *bool
-	ControlTemp json.Number
+	Enabled *bool `json:",omitempty"`
+	ControlTemp json.Number `json:",omitempty"`
 }
 
 type InputBooster struct {
-	Head string
-	Tail string
+	Head string `json:",omitempty"`
+	Tail string `json:",omitempty"`
 }
 
 type SecSlow struct {
-	Enabled *bool
-	Enforced *bool
-	TimerRate json.Number
+	Enabled *bool `json:",omitempty"`
+	Enforced *bool `json:",omitempty"`
+	TimerRate json.Number `json:",omitempty"`
 }
 
 func (dev *Device) CacheProfile(name string) error {
@@ -104,9 +106,28 @@ func (dev *Device) CacheProfile(name string) error {
 func (dev *Device) SyncProfile() error {
 	Debug("Syncing profile")
 	if dev.Buffered == nil {return nil}
+	dev.orderPairs()
+	dev.BufferedPairs = nil
+	if dev.DryRun {
+		dev.planBuffered()
+		dev.Buffered = make([]BufferedWrite, 0)
+		return nil
+	}
+	owned := dev.beginTransaction()
 	for i := 0; i < len(dev.Buffered); i++ {
 		bw := dev.Buffered[i]
-		if err := dev.write(bw.Path, bw.Data); err != nil {return err}
+		dev.journal(bw.Path)
+		if err := dev.write(bw.Path, bw.Data); err != nil {
+			dev.Buffered = make([]BufferedWrite, 0)
+			txErr := &TransactionError{Path: bw.Path, Data: bw.Data, Err: err}
+			if owned {
+				dev.rollbackTransaction(txErr)
+			}
+			return txErr
+		}
+	}
+	if owned {
+		dev.commitTransaction()
 	}
 
 	//Reset the buffer for the next profile chain
@@ -118,7 +139,7 @@ func (dev *Device) SyncProfile() error {
 		return fmt.Errorf("failed to find current profile after syncing writes")
 	}
 	for clusterName, cluster := range profile.Clusters {
-		if cluster.CPUFreq.Governor == "powerpulse" {
+		if cluster.CPUFreq != nil && cluster.CPUFreq.Governor == "powerpulse" {
 			go dev.GovernCPU(clusterName)
 		}
 	}
@@ -126,213 +147,82 @@ func (dev *Device) SyncProfile() error {
 	return nil
 }
 
-func (dev *Device) GetProfile(name string) *Profile {
-	profile := &Profile{}
+func (dev *Device) HasProfile(name string) bool {
+	_, exists := dev.Profiles[name]
+	return exists
+}
 
-	index := -1
-	for i := 0; i < len(dev.ProfileInheritance); i++ {
-		if dev.ProfileInheritance[i] == name {
-			index = i
-			break
-		}
+//Returns a copy of the resolved profile that the caller is free to modify, or nil if it doesn't exist
+func (dev *Device) GetProfile(name string) *Profile {
+	if !dev.HasProfile(name) {
+		return nil
 	}
+	if resolved, exists := dev.ProfilesResolved[name]; exists {
+		return copyProfile(resolved)
+	}
+	return dev.resolveProfile(name)
+}
+
+func (dev *Device) resolveProfile(name string) *Profile {
+	profile := &Profile{}
 
 	//Inherit any parent profiles if available
-	if index > 0 {
-		for i := 0; i < index; i++ {
-			dev.getProfile(dev.ProfileInheritance[i], profile)
-		}
+	for _, parent := range dev.profileChain(name) {
+		dev.getProfile(parent, profile)
 	}
-	dev.getProfile(name, profile)
 
 	return profile
 }
 
+//Resolves every profile once, so the parsed profiles are never touched again until the next reload
+func (dev *Device) resolveProfiles() {
+	resolved := make(map[string]*Profile)
+	for name := range dev.Profiles {
+		resolved[name] = dev.resolveProfile(name)
+	}
+	dev.ProfilesResolved = resolved
+}
+
+//Merges the parsed settings of name into dst, copying them first so dst never shares anything with dev.Profiles
 func (dev *Device) getProfile(name string, dst *Profile) {
-	profile := dev.Profiles[name]
+	profile := copyProfile(dev.Profiles[name])
 	if profile == nil {
 		return
 	}
+	mergeProfile(dst, profile)
+}
 
-	if dst.Clusters == nil {
-		dst.Clusters = make(map[string]*Cluster)
-	}
-	for clusterName, cluster := range profile.Clusters {
-		if _, exists := dst.Clusters[clusterName]; !exists {
-			dst.Clusters[clusterName] = cluster
-			continue
-		}
-		if dst.Clusters[clusterName].CPUFreq == nil {
-			dst.Clusters[clusterName].CPUFreq = cluster.CPUFreq
-			continue
-		}
-		if cluster.CPUFreq != nil {
-			if cluster.CPUFreq.Max.String() != "" {
-				dst.Clusters[clusterName].CPUFreq.Max = cluster.CPUFreq.Max
-			}
-			if cluster.CPUFreq.Min.String() != "" {
-				dst.Clusters[clusterName].CPUFreq.Min = cluster.CPUFreq.Min
-			}
-			if cluster.CPUFreq.Speed.String() != "" {
-				dst.Clusters[clusterName].CPUFreq.Speed = cluster.CPUFreq.Speed
-			}
-			if cluster.CPUFreq.Governor != "" {
-				dst.Clusters[clusterName].CPUFreq.Governor = cluster.CPUFreq.Governor
-			}
-			if dst.Clusters[clusterName].CPUFreq.Governors == nil {
-				dst.Clusters[clusterName].CPUFreq.Governors = cluster.CPUFreq.Governors
-			} else if cluster.CPUFreq.Governors != nil {
-				for data, value := range cluster.CPUFreq.Governors {
-					dst.Clusters[clusterName].CPUFreq.Governors[data] = value
-				}
-			}
-		}
-	}
-
-	if dst.CPUSets == nil {
-		dst.CPUSets = make(map[string]*CPUSet)
-	}
-	for setName, set := range profile.CPUSets {
-		if _, exists := dst.CPUSets[setName]; exists {
-			if set.CPUs != "" {
-				dst.CPUSets[setName].CPUs = set.CPUs
-			}
-			if set.CPUExclusive != nil {
-				dst.CPUSets[setName].CPUExclusive = set.CPUExclusive
-			}
-		} else {
-			dst.CPUSets[setName] = set
-		}
-	}
-
-	if dst.GPU == nil {
-		dst.GPU = profile.GPU
-	} else if profile.GPU != nil {
-		if profile.GPU.DVFS != nil {
-			if dst.GPU.DVFS == nil {
-				dst.GPU.DVFS = profile.GPU.DVFS
-			} else {
-				if profile.GPU.DVFS.Max.String() != "" {
-					dst.GPU.DVFS.Max = profile.GPU.DVFS.Max
-				}
-				if profile.GPU.DVFS.Min.String() != "" {
-					dst.GPU.DVFS.Min = profile.GPU.DVFS.Min
-				}
-			}
-		}
-		if profile.GPU.Highspeed != nil {
-			if dst.GPU.Highspeed == nil {
-				dst.GPU.Highspeed = profile.GPU.Highspeed
-			} else {
-				if profile.GPU.Highspeed.Clock.String() != "" {
-					dst.GPU.Highspeed.Clock = profile.GPU.Highspeed.Clock
-				}
-				if profile.GPU.Highspeed.Load.String() != "" {
-					dst.GPU.Highspeed.Load = profile.GPU.Highspeed.Load
-				}
-			}
-		}
-	}
-
-	if dst.Kernel == nil {
-		dst.Kernel = profile.Kernel
-	} else if profile.Kernel != nil {
-		if profile.Kernel.DynamicHotplug != nil {
-			dst.Kernel.DynamicHotplug = profile.Kernel.DynamicHotplug
-		}
-		if profile.Kernel.PowerEfficient != nil {
-			dst.Kernel.PowerEfficient = profile.Kernel.PowerEfficient
-		}
-		if profile.Kernel.HMP != nil {
-			if dst.Kernel.HMP == nil {
-				dst.Kernel.HMP = profile.Kernel.HMP
-			} else {
-				if profile.Kernel.HMP.Boost != nil {
-					dst.Kernel.HMP.Boost = profile.Kernel.HMP.Boost
-				}
-				if profile.Kernel.HMP.Semiboost != nil {
-					dst.Kernel.HMP.Semiboost = profile.Kernel.HMP.Semiboost
-				}
-				if profile.Kernel.HMP.ActiveDownMigration != nil {
-					dst.Kernel.HMP.ActiveDownMigration = profile.Kernel.HMP.ActiveDownMigration
-				}
-				if profile.Kernel.HMP.AggressiveUpMigration != nil {
-					dst.Kernel.HMP.AggressiveUpMigration = profile.Kernel.HMP.AggressiveUpMigration
-				}
-				if profile.Kernel.HMP.Threshold != nil {
-					if dst.Kernel.HMP.Threshold == nil {
-						dst.Kernel.HMP.Threshold = profile.Kernel.HMP.Threshold
-					} else {
-						if profile.Kernel.HMP.Threshold.Down.String() != "" {
-							dst.Kernel.HMP.Threshold.Down = profile.Kernel.HMP.Threshold.Down
-						}
-						if profile.Kernel.HMP.Threshold.Up.String() != "" {
-							dst.Kernel.HMP.Threshold.Up = profile.Kernel.HMP.Threshold.Up
-						}
-					}
-				}
-				if profile.Kernel.HMP.SbThreshold != nil {
-					if dst.Kernel.HMP.SbThreshold == nil {
-						dst.Kernel.HMP.SbThreshold = profile.Kernel.HMP.SbThreshold
-					} else {
-						if profile.Kernel.HMP.SbThreshold.Down.String() != "" {
-							dst.Kernel.HMP.SbThreshold.Down = profile.Kernel.HMP.SbThreshold.Down
-						}
-						if profile.Kernel.HMP.SbThreshold.Up.String() != "" {
-							dst.Kernel.HMP.SbThreshold.Up = profile.Kernel.HMP.SbThreshold.Up
-						}
-					}
-				}
-			}
-		}
-	}
-
-	if dst.IPA == nil {
-		dst.IPA = profile.IPA
-	} else if profile.IPA != nil {
-		if profile.IPA.Enabled != nil {
-			dst.IPA.Enabled = profile.IPA.Enabled
-		}
-		if profile.IPA.ControlTemp.String() != "" {
-			dst.IPA.ControlTemp = profile.IPA.ControlTemp
-		}
+//Returns the live profile without copying it, so it must not be modified
+func (dev *Device) GetProfileNow() *Profile {
+	if dev.ProfileApplied != nil {
+		return dev.ProfileApplied
 	}
+	return dev.ProfilesResolved[dev.Profile]
+}
 
-	if dst.InputBooster == nil {
-		dst.InputBooster = profile.InputBooster
-	} else if profile.InputBooster != nil {
-		if profile.InputBooster.Head != "" {
-			dst.InputBooster.Head = profile.InputBooster.Head
-		}
-		if profile.InputBooster.Tail != "" {
-			dst.InputBooster.Tail = profile.InputBooster.Tail
-		}
+//Describes what's applied for logs and status, such as "balanced+camera+thermal"
+func (dev *Device) AppliedName() string {
+	name := dev.Profile
+	for _, overlay := range dev.ProfileOverlays {
+		name += "+" + overlay
 	}
-
-	if dst.SecSlow == nil {
-		dst.SecSlow = profile.SecSlow
-	} else if profile.SecSlow != nil {
-		if profile.SecSlow.Enabled != nil {
-			dst.SecSlow.Enabled = profile.SecSlow.Enabled
-		}
-		if profile.SecSlow.Enforced != nil {
-			dst.SecSlow.Enforced = profile.SecSlow.Enforced
-		}
-		if profile.SecSlow.TimerRate.String() != "" {
-			dst.SecSlow.TimerRate = profile.SecSlow.TimerRate
-		}
+	if dev.ProfileThrottled {
+		name += "+thermal"
 	}
+	return name
 }
 
-func (dev *Device) GetProfileNow() *Profile {
-	return dev.GetProfile(dev.Profile)
+func (dev *Device) SetProfile(name string) error {
+	return dev.SetProfileOverlays(name, nil)
 }
 
-func (dev *Device) SetProfile(name string) error {
-	//Save the requested profile if we're locked out
+//Layers the settings each overlay profile sets itself on top of the named profile, in order
+func (dev *Device) SetProfileOverlays(name string, overlays []string) error {
 	if dev.ProfileLock {
-		profileNow = name
-		return fmt.Errorf("not allowed to set %s yet, locked to %s", name, dev.Profile)
+		return fmt.Errorf("%w: not allowed to set %s yet, locked to %s", ErrLocked, name, dev.Profile)
+	}
+	if !dev.HasProfile(name) {
+		return fmt.Errorf("%w: %s", ErrNoProfile, name)
 	}
 
 	dev.ProfileMutex.Lock()
@@ -347,18 +237,60 @@ func (dev *Device) SetProfile(name string) error {
 	if profile == nil {
 		return fmt.Errorf("profile %s does not exist", name)
 	}
+	for _, overlay := range overlays {
+		if !dev.HasProfile(overlay) {
+			return fmt.Errorf("%w: overlay %s", ErrNoProfile, overlay)
+		}
+		dev.getProfile(overlay, profile)
+	}
+	capped, active, err := dev.applyThrottle(profile)
+	if err != nil {
+		return err
+	}
+	lastName, lastOverlays, lastThrottled, lastProfile := dev.Profile, dev.ProfileOverlays, dev.ProfileThrottled, dev.ProfileApplied
 	dev.Profile = name
+	dev.ProfileOverlays = append([]string{}, overlays...)
+	dev.ProfileThrottled = capped
+	dev.ProfileApplied = profile
+	name = dev.AppliedName()
+
+	//Apply everything as one transaction, so a failure anywhere puts back the last profile
+	dev.beginTransaction()
+	if err := dev.applyProfile(profile, name); err != nil {
+		dev.BufferedPairs = nil
+		dev.Buffered = make([]BufferedWrite, 0)
+		txErr, isTx := err.(*TransactionError)
+		if !isTx {
+			txErr = &TransactionError{Err: err}
+		}
+		dev.rollbackTransaction(txErr)
+		dev.Profile, dev.ProfileOverlays, dev.ProfileThrottled, dev.ProfileApplied = lastName, lastOverlays, lastThrottled, lastProfile
+		if !isTx {
+			if txErr.RolledBack == 0 {
+				return err
+			}
+			return fmt.Errorf("%w, rolled back %d paths", err, txErr.RolledBack)
+		}
+		return txErr
+	}
+	dev.commitTransaction()
+	//Only now are the caps written, a rolled back apply leaves the last ones to release
+	if !dev.DryRun {
+		throttleCapped = active
+	}
 
+	deltaTime := time.Now().Sub(startTime).Milliseconds()
+	Info("PowerPulse finished applying %s in %dms", name, deltaTime)
+	return nil
+}
+
+func (dev *Device) applyProfile(profile *Profile, name string) error {
 	//Set the new profile and sync it live
 	if err := dev.setProfile(profile, name); err != nil {return err}
 	if err := dev.SyncProfile(); err != nil {return err}
 
 	//Handle cpusets separately for safety reasons
-	if err := dev.setCpusets(profile); err != nil {return err}
-
-	deltaTime := time.Now().Sub(startTime).Milliseconds()
-	Info("PowerPulse finished applying %s in %dms", name, deltaTime)
-	return nil
+	return dev.setCpusets(profile)
 }
 
 func (dev *Device) setProfile(profile *Profile, name string) error {
@@ -390,14 +322,21 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 					dev.BufferWrite(governorPath, freq.Governor)
 				}
 			}
-			max := freq.Max.String()
+			domain := dev.cpuFreqDomain(clusterName)
+			max, err := freq.Max.Resolve(domain)
+			if err != nil {
+				return fmt.Errorf("clusters/%s/cpufreq/max: %v", clusterName, err)
+			}
 			if max != "" {
 				Debug("> CPUFreq > Max = %s", max)
 				maxPath := pathJoin(freqPath, pathFreq.Max)
 				Debug(maxPath)
 				dev.BufferWrite(maxPath, max)
 			}
-			min := freq.Min.String()
+			min, err := freq.Min.Resolve(domain)
+			if err != nil {
+				return fmt.Errorf("clusters/%s/cpufreq/min: %v", clusterName, err)
+			}
 			if min != "" {
 				minPath := pathJoin(freqPath, pathFreq.Min)
 				if debug {
@@ -406,7 +345,13 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 				}
 				dev.BufferWrite(minPath, min)
 			}
-			speed := freq.Speed.String()
+			if max != "" && min != "" {
+				dev.BufferPair(pathJoin(freqPath, pathFreq.Min), pathJoin(freqPath, pathFreq.Max))
+			}
+			speed, err := freq.Speed.Resolve(domain)
+			if err != nil {
+				return fmt.Errorf("clusters/%s/cpufreq/speed: %v", clusterName, err)
+			}
 			if speed != "" {
 				speedPath := pathJoin(freqPath, pathFreq.Speed)
 				if debug {
@@ -452,7 +397,11 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 		if gpu.DVFS != nil {
 			dvfs := gpu.DVFS
 			Debug("Loading GPU DVFS")
-			max := dvfs.Max.String()
+			domain := dev.gpuFreqDomain()
+			max, err := dvfs.Max.Resolve(domain)
+			if err != nil {
+				return fmt.Errorf("gpu/dvfs/max: %v", err)
+			}
 			if max != "" {
 				maxPath := pathJoin(gpuPath, dev.Paths.GPU.DVFS.Max)
 				if debug {
@@ -461,7 +410,10 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 				}
 				dev.BufferWrite(maxPath, max)
 			}
-			min := dvfs.Min.String()
+			min, err := dvfs.Min.Resolve(domain)
+			if err != nil {
+				return fmt.Errorf("gpu/dvfs/min: %v", err)
+			}
 			if min != "" {
 				minPath := pathJoin(gpuPath, dev.Paths.GPU.DVFS.Min)
 				if debug {
@@ -470,6 +422,9 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 				}
 				dev.BufferWrite(minPath, min)
 			}
+			if max != "" && min != "" {
+				dev.BufferPair(pathJoin(gpuPath, dev.Paths.GPU.DVFS.Min), pathJoin(gpuPath, dev.Paths.GPU.DVFS.Max))
+			}
 		}
 		if gpu.Highspeed != nil {
 			hs := gpu.Highspeed
@@ -574,6 +529,9 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 					}
 					dev.BufferWrite(upPath, up)
 				}
+				if down != "" && up != "" {
+					dev.BufferPair(pathJoin(hmpPath, hmpPaths.Threshold.Down), pathJoin(hmpPath, hmpPaths.Threshold.Up))
+				}
 			}
 			if hmp.SbThreshold != nil {
 				thld := hmp.SbThreshold
@@ -595,6 +553,9 @@ func (dev *Device) setProfile(profile *Profile, name string) error {
 					}
 					dev.BufferWrite(upPath, up)
 				}
+				if down != "" && up != "" {
+					dev.BufferPair(pathJoin(hmpPath, hmpPaths.SbThreshold.Down), pathJoin(hmpPath, hmpPaths.SbThreshold.Up))
+				}
 			}
 		}
 	}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const RULES_INTERVAL_DEFAULT = 5000 //Milliseconds between rule evaluations
+
+//Switches to Profile while every condition in When holds, the first matching rule winning
+//Rules are edge triggered, so a profile requested while a rule is active stays until the next rule change
+type Rule struct {
+	Name string
+	Profile string
+	When []string //Conditions such as "battery.capacity < 15" or "charging == 0"
+	Hysteresis json.Number //How far past their threshold numeric conditions have to recover before an active rule releases
+	conditions []ruleCondition
+	hysteresis float64
+}
+
+type ruleCondition struct {
+	Sensor string
+	Op string
+	Value string
+	Number float64
+	Numeric bool
+}
+
+//Two character operators first, so "<=" isn't read as "<"
+var ruleOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+var (
+	rulesMutex        sync.Mutex
+	ruleActive        string //Name of the rule that last switched profiles
+	ruleActiveProfile string
+	ruleRestore       string //Profile to go back to once no rule applies
+)
+
+func parseCondition(condition string) (ruleCondition, error) {
+	for _, op := range ruleOperators {
+		i := strings.Index(condition, op)
+		if i < 0 {
+			continue
+		}
+		cond := ruleCondition{
+			Sensor: strings.ToLower(strings.TrimSpace(condition[:i])),
+			Op: op,
+			Value: strings.TrimSpace(condition[i+len(op):]),
+		}
+		if cond.Value == "" {
+			return cond, fmt.Errorf("missing value in condition %s", condition)
+		}
+		if number, err := strconv.ParseFloat(cond.Value, 64); err == nil {
+			cond.Number, cond.Numeric = number, true
+		} else if op != "==" && op != "!=" {
+			return cond, fmt.Errorf("condition %s compares a string with %s", condition, op)
+		}
+		return cond, nil
+	}
+	return ruleCondition{}, fmt.Errorf("missing operator in condition %s", condition)
+}
+
+//Loosens numeric thresholds by hysteresis, which is only given for the active rule
+func (cond ruleCondition) eval(value string, hysteresis float64) (bool, error) {
+	if !cond.Numeric {
+		equal := strings.EqualFold(value, cond.Value)
+		if cond.Op == "==" {
+			return equal, nil
+		}
+		return !equal, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false, fmt.Errorf("sensor %s is not numeric: %s", cond.Sensor, value)
+	}
+	switch cond.Op {
+	case "<":
+		return number < cond.Number + hysteresis, nil
+	case "<=":
+		return number <= cond.Number + hysteresis, nil
+	case ">":
+		return number > cond.Number - hysteresis, nil
+	case ">=":
+		return number >= cond.Number - hysteresis, nil
+	case "==":
+		return number == cond.Number, nil
+	}
+	return number != cond.Number, nil
+}
+
+func (dev *Device) initRules() error {
+	if dev.RulesInterval.String() != "" {
+		if interval, err := dev.RulesInterval.Int64(); err != nil || interval <= 0 {
+			return fmt.Errorf("rules_interval: invalid interval %s", dev.RulesInterval)
+		}
+	}
+	names := make(map[string]bool)
+	for i, rule := range dev.Rules {
+		if rule == nil {
+			return fmt.Errorf("rules/%d: missing rule", i)
+		}
+		if rule.Name == "" {
+			rule.Name = strconv.Itoa(i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rules/%s: duplicate rule name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		rule.Profile = strings.ReplaceAll(strings.ToLower(rule.Profile), " ", "_")
+		if !dev.HasProfile(rule.Profile) {
+			return fmt.Errorf("rules/%s: %w: %s", rule.Name, ErrNoProfile, rule.Profile)
+		}
+		if len(rule.When) == 0 {
+			return fmt.Errorf("rules/%s: missing conditions", rule.Name)
+		}
+		rule.conditions = make([]ruleCondition, 0, len(rule.When))
+		for _, condition := range rule.When {
+			cond, err := parseCondition(condition)
+			if err != nil {
+				return fmt.Errorf("rules/%s: %v", rule.Name, err)
+			}
+			if err := dev.validSensor(cond.Sensor); err != nil {
+				return fmt.Errorf("rules/%s: %v", rule.Name, err)
+			}
+			rule.conditions = append(rule.conditions, cond)
+		}
+		if rule.Hysteresis.String() != "" {
+			hysteresis, err := rule.Hysteresis.Float64()
+			if err != nil || hysteresis < 0 {
+				return fmt.Errorf("rules/%s: invalid hysteresis %s", rule.Name, rule.Hysteresis)
+			}
+			rule.hysteresis = hysteresis
+		}
+		Debug("Found rule %s: %s when %s", rule.Name, rule.Profile, strings.Join(rule.When, " and "))
+	}
+	return nil
+}
+
+func (rule *Rule) matches(dev *Device, readings sensorReadings, active bool) bool {
+	hysteresis := 0.0
+	if active {
+		hysteresis = rule.hysteresis
+	}
+	for _, cond := range rule.conditions {
+		value, err := dev.readSensor(cond.Sensor, readings)
+		if err != nil {
+			Debug("Rule %s: %v", rule.Name, err)
+			return false
+		}
+		ok, err := cond.eval(value, hysteresis)
+		if err != nil {
+			Debug("Rule %s: %v", rule.Name, err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//Evaluates the rules until the daemon exits, picking up reloaded manifests as it goes
+func runRules() {
+	for {
+		interval := int64(RULES_INTERVAL_DEFAULT)
+		if dev := currentDevice(); dev != nil {
+			if dev.RulesInterval.String() != "" {
+				interval, _ = dev.RulesInterval.Int64()
+			}
+			if len(dev.Rules) > 0 {
+				evaluateRules(dev)
+			}
+		}
+		time.Sleep(time.Millisecond * time.Duration(interval))
+	}
+}
+
+func evaluateRules(dev *Device) {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+
+	readings := make(sensorReadings)
+	var target *Rule
+	for _, rule := range dev.Rules {
+		if rule.matches(dev, readings, rule.Name == ruleActive) {
+			target = rule
+			break
+		}
+	}
+
+	if target == nil {
+		if ruleActive == "" {
+			return
+		}
+		if currentDevice() != dev {
+			return //Reloaded while reading the sensors, the next check uses the new rules
+		}
+		Info("Rule %s no longer applies", ruleActive)
+		publish(Event{Type: EventRule, Source: "rule:" + ruleActive, Profile: ruleActiveProfile, Detail: "off"})
+		//Only go back if nothing else picked a profile while the rule was active
+		if now := requestedProfile(); now == ruleActiveProfile && ruleRestore != "" && ruleRestore != now {
+			switchProfile(ruleRestore, "rule:" + ruleActive)
+		}
+		ruleActive, ruleActiveProfile, ruleRestore = "", "", ""
+		return
+	}
+	if target.Name == ruleActive {
+		return
+	}
+	if currentDevice() != dev {
+		return
+	}
+
+	Info("Rule %s applies, switching to %s", target.Name, target.Profile)
+	publish(Event{Type: EventRule, Source: "rule:" + target.Name, Profile: target.Profile, Detail: "on"})
+	now := requestedProfile()
+	if ruleActive == "" {
+		ruleRestore = now
+	}
+	ruleActive, ruleActiveProfile = target.Name, target.Profile
+	if now != target.Profile {
+		switchProfile(target.Profile, "rule:" + target.Name)
+	}
+}
+
+//Applies a profile picked automatically, where a boot lock only defers it
+func switchProfile(profile, source string) {
+	if err := setProfile(profile, source); err != nil && !errors.Is(err, ErrLocked) {
+		Error("Error applying profile %s for %s: %v", profile, source, err)
+	}
+}
+
+//Returns the name of the rule that's currently in control, if any
+func activeRule() string {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	return ruleActive
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+//Sensors are named by where they read from:
+//- "charging": 1 while an external supply is online or the battery reports charging or full, otherwise 0
+//- "<supply>.<attribute>": an attribute of a power supply, such as "battery.capacity", "battery.status" or "ac.online"
+//- "thermal.<zone>": the temperature in °C of a thermal zone, by type or directory name, such as "thermal.battery"
+//  Zones report millidegrees, unless thermal_units gives the zone another unit
+//- "loadavg": the 1 minute load average
+//- "psi.<resource>": the percentage of the last 10 seconds some tasks stalled on cpu, io or memory, such as "psi.cpu"
+//- "<name>": a virtual sensor defined in the manifest's sensors section
+const (
+	SENSOR_CHARGING = "charging"
+	SENSOR_THERMAL  = "thermal."
+	SENSOR_LOADAVG  = "loadavg"
+	SENSOR_PSI      = "psi."
+)
+
+//Divisors of the units thermal zones report in, the kernel documents millidegrees but some drivers differ
+var thermalUnits = map[string]float64{
+	"millicelsius": 1000,
+	"decicelsius":  10,
+	"celsius":      1,
+}
+
+func (dev *Device) validSensor(name string) error {
+	if name == SENSOR_CHARGING || name == SENSOR_LOADAVG {
+		return nil
+	}
+	if _, exists := dev.Sensors[name]; exists {
+		return nil
+	}
+	if strings.HasPrefix(name, SENSOR_THERMAL) {
+		if strings.TrimPrefix(name, SENSOR_THERMAL) == "" {
+			return fmt.Errorf("missing thermal zone in sensor %s", name)
+		}
+		return nil
+	}
+	if strings.HasPrefix(name, SENSOR_PSI) {
+		switch strings.TrimPrefix(name, SENSOR_PSI) {
+		case "cpu", "io", "memory":
+			return nil
+		}
+		return fmt.Errorf("unknown pressure resource in sensor %s", name)
+	}
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[1], "/") {
+		return fmt.Errorf("unknown sensor %s", name)
+	}
+	return nil
+}
+
+//Reads sensors at most once per evaluation, so every condition sees the same state
+type sensorReadings map[string]string
+
+func (dev *Device) readSensor(name string, readings sensorReadings) (string, error) {
+	if value, exists := readings[name]; exists {
+		return value, nil
+	}
+
+	var value string
+	var err error
+	switch {
+	case name == SENSOR_CHARGING:
+		value, err = dev.readCharging()
+	case strings.HasPrefix(name, SENSOR_THERMAL):
+		value, err = dev.readThermal(strings.TrimPrefix(name, SENSOR_THERMAL))
+	case name == SENSOR_LOADAVG:
+		value, err = readLoadavg()
+	case strings.HasPrefix(name, SENSOR_PSI):
+		value, err = readPressure(strings.TrimPrefix(name, SENSOR_PSI))
+	case dev.Sensors[name] != nil:
+		value, err = dev.readVirtual(dev.Sensors[name], readings)
+	default:
+		if dev.Paths.PowerSupply == "" {
+			return "", fmt.Errorf("no power_supply path for sensor %s", name)
+		}
+		parts := strings.SplitN(name, ".", 2)
+		value, err = readValue(pathJoin(dev.Paths.PowerSupply, parts[0], parts[1]))
+	}
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if readings != nil {
+		readings[name] = value
+	}
+	return value, nil
+}
+
+func (dev *Device) readCharging() (string, error) {
+	if dev.Paths.PowerSupply == "" {
+		return "", fmt.Errorf("no power_supply path")
+	}
+	supplies, err := ioutil.ReadDir(dev.Paths.PowerSupply)
+	if err != nil {
+		return "", err
+	}
+	for _, supply := range supplies {
+		supplyPath := pathJoin(dev.Paths.PowerSupply, supply.Name())
+		supplyType, _ := readValue(pathJoin(supplyPath, "type"))
+		if strings.EqualFold(supplyType, "Battery") {
+			status, _ := readValue(pathJoin(supplyPath, "status"))
+			if strings.EqualFold(status, "Charging") || strings.EqualFold(status, "Full") {
+				return "1", nil
+			}
+			continue
+		}
+		if online, _ := readValue(pathJoin(supplyPath, "online")); online == "1" {
+			return "1", nil
+		}
+	}
+	return "0", nil
+}
+
+func (dev *Device) readThermal(zone string) (string, error) {
+	if dev.Paths.Thermal == "" {
+		return "", fmt.Errorf("no thermal path")
+	}
+	zones, err := ioutil.ReadDir(dev.Paths.Thermal)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range zones {
+		if !strings.HasPrefix(entry.Name(), "thermal_zone") {
+			continue
+		}
+		zonePath := pathJoin(dev.Paths.Thermal, entry.Name())
+		zoneType, _ := readValue(pathJoin(zonePath, "type"))
+		if entry.Name() != zone && !strings.EqualFold(zoneType, zone) {
+			continue
+		}
+		temp, err := readValue(pathJoin(zonePath, "temp"))
+		if err != nil {
+			return "", err
+		}
+		celsius, err := strconv.ParseFloat(strings.TrimSpace(temp), 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid temperature %s for thermal zone %s", temp, zone)
+		}
+		divisor := thermalUnits["millicelsius"]
+		if unit, exists := dev.ThermalUnits[zone]; exists {
+			divisor = thermalUnits[unit]
+		}
+		return strconv.FormatFloat(celsius / divisor, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("thermal zone %s not found", zone)
+}
+
+func readLoadavg() (string, error) {
+	loadavg, err := readValue(pathJoin(procPath, "loadavg"))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(loadavg)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty loadavg")
+	}
+	return fields[0], nil
+}
+
+//Reads the avg10 of the "some" line, which looks like "some avg10=1.23 avg60=0.50 avg300=0.10 total=12345"
+func readPressure(resource string) (string, error) {
+	pressure, err := readValue(pathJoin(procPath, "pressure", resource))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(pressure, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strings.TrimPrefix(field, "avg10="), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no avg10 in %s pressure", resource)
+}
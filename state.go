@@ -0,0 +1,138 @@
+package main
+
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//Every string returned here is owned by the caller and must be released with PowerPulse_FreeString
+//NULL is returned when there's nothing to report, with the reason available from PowerPulse_GetLastError
+
+//Returns the device and the requested profile as of one moment, as HAL threads call in while the daemon changes them
+func stateSnapshot() (*Device, string) {
+	lock.Lock()
+	defer lock.Unlock()
+	return device, profileNow
+}
+
+//Returns the profile currently applied to the device, which may be a screen off or boot profile
+//Overlays and thermal caps on top of it aren't included, see PowerPulse_GetResolvedProfileJSON for the settings in effect
+//export PowerPulse_GetActiveProfile
+func PowerPulse_GetActiveProfile() *C.char {
+	if err := initialize(); err != nil {
+		setStatus(err)
+		return nil
+	}
+	setStatus(nil)
+	lock.Lock()
+	profile := device.Profile
+	lock.Unlock()
+	if profile == "" {
+		return nil
+	}
+	return C.CString(profile)
+}
+
+//Returns the profile the user or framework last asked for, which is restored once temporary profiles end
+//export PowerPulse_GetRequestedProfile
+func PowerPulse_GetRequestedProfile() *C.char {
+	if err := initialize(); err != nil {
+		setStatus(err)
+		return nil
+	}
+	setStatus(nil)
+	_, requested := stateSnapshot()
+	if requested == "" {
+		return nil
+	}
+	return C.CString(requested)
+}
+
+//Returns the selectable profiles as a comma-separated list, from lowest to highest performing
+//export PowerPulse_GetProfileOrder
+func PowerPulse_GetProfileOrder() *C.char {
+	if err := initialize(); err != nil {
+		setStatus(err)
+		return nil
+	}
+	setStatus(nil)
+	dev, _ := stateSnapshot()
+	return C.CString(strings.Join(dev.ProfileOrder, ","))
+}
+
+//Returns the LineageOS profile ids as a JSON object of ids to profile names, the same ids HINT_LINEAGE_SET_PROFILE accepts
+//The ids from 0 up are what FEATURE_SUPPORTED_PROFILES counts
+//export PowerPulse_GetLineageProfilesJSON
+func PowerPulse_GetLineageProfilesJSON() *C.char {
+	if err := initialize(); err != nil {
+		setStatus(err)
+		return nil
+	}
+	dev, _ := stateSnapshot()
+	lineageJSON, err := json.Marshal(dev.lineageTable())
+	if err != nil {
+		setStatus(fmt.Errorf("failed to marshal lineage profiles: %v", err))
+		return nil
+	}
+	setStatus(nil)
+	return C.CString(string(lineageJSON))
+}
+
+//Returns the LineageOS profile id of the profile currently requested, or -2 when the framework can't select it
+//export PowerPulse_GetLineageProfileId
+func PowerPulse_GetLineageProfileId() int32 {
+	if err := initialize(); err != nil {
+		setStatus(err)
+		return -2
+	}
+	setStatus(nil)
+	dev, requested := stateSnapshot()
+	if id, exists := dev.LineageId(requested); exists {
+		return id
+	}
+	return -2
+}
+
+//Returns the named profile as JSON after inheritance, or the settings in effect when name is NULL or empty
+//Those include the active overlays and thermal caps
+//export PowerPulse_GetResolvedProfileJSON
+func PowerPulse_GetResolvedProfileJSON(name *C.char) *C.char {
+	profileJSON, err := getResolvedProfileJSON(C.GoString(name))
+	setStatus(err)
+	if err != nil {
+		return nil
+	}
+	return C.CString(profileJSON)
+}
+func getResolvedProfileJSON(name string) (string, error) {
+	if err := initialize(); err != nil {
+		return "", err
+	}
+	if name == "" {
+		//Applied profiles are replaced, never modified, so it's safe to marshal outside of lock
+		lock.Lock()
+		profile, applied := device.GetProfileNow(), device.AppliedName()
+		lock.Unlock()
+		if profile == nil {
+			return "", fmt.Errorf("%w: nothing is applied yet", ErrNoProfile)
+		}
+		profileJSON, err := json.Marshal(profile)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal applied profile %s: %v", applied, err)
+		}
+		return string(profileJSON), nil
+	}
+	dev, _ := stateSnapshot()
+	name = strings.ReplaceAll(strings.ToLower(name), " ", "_")
+	if !dev.HasProfile(name) {
+		return "", fmt.Errorf("%w: %s", ErrNoProfile, name)
+	}
+	profileJSON, err := json.Marshal(dev.GetProfile(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal profile %s: %v", name, err)
+	}
+	return string(profileJSON), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+// #include <stdlib.h>
+// #include <string.h>
+//
+// /* Like errno, binder calls in from many threads and each one gets the error from its own last call */
+// static __thread char *pp_last_error;
+// static inline void pp_set_last_error(char *err) { free(pp_last_error); pp_last_error = err; }
+// static inline char *pp_dup_last_error(void) { return pp_last_error ? strdup(pp_last_error) : NULL; }
+//
+// /* Status codes returned by the synchronous exports */
+// enum {
+// 	PP_OK = 0,
+// 	PP_ERROR = -1,             /* Anything without a more specific code, see PowerPulse_GetLastError */
+// 	PP_ERROR_NOT_READY = -2,   /* The manifest failed to load, so there's no device to work with */
+// 	PP_ERROR_NO_PROFILE = -3,  /* The requested profile isn't in the manifest */
+// 	PP_ERROR_LOCKED = -4,      /* The request was recorded, but deferred until the boot profile is released */
+// 	PP_ERROR_UNSUPPORTED = -5, /* The hint or feature isn't supported */
+// };
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+//Mirrored from the preamble so they land in libpowerpulse.h
+const (
+	PP_OK                = C.PP_OK
+	PP_ERROR             = C.PP_ERROR
+	PP_ERROR_NOT_READY   = C.PP_ERROR_NOT_READY
+	PP_ERROR_NO_PROFILE  = C.PP_ERROR_NO_PROFILE
+	PP_ERROR_LOCKED      = C.PP_ERROR_LOCKED
+	PP_ERROR_UNSUPPORTED = C.PP_ERROR_UNSUPPORTED
+)
+
+var (
+	ErrNotReady    = errors.New("not initialized")
+	ErrNoProfile   = errors.New("profile does not exist")
+	ErrLocked      = errors.New("profile is locked")
+	ErrUnsupported = errors.New("not supported")
+)
+
+//Records the outcome of a synchronous call for PowerPulse_GetLastError and translates it into a status code
+//Exports run on the thread that called them, so this must only be called from the export itself
+func setStatus(err error) int32 {
+	var msg *C.char
+	if err != nil {
+		msg = C.CString(err.Error())
+	}
+	C.pp_set_last_error(msg)
+
+	switch {
+	case err == nil:
+		return PP_OK
+	case errors.Is(err, ErrNotReady):
+		return PP_ERROR_NOT_READY
+	case errors.Is(err, ErrNoProfile):
+		return PP_ERROR_NO_PROFILE
+	case errors.Is(err, ErrLocked):
+		return PP_ERROR_LOCKED
+	case errors.Is(err, ErrUnsupported):
+		return PP_ERROR_UNSUPPORTED
+	}
+	return PP_ERROR
+}
+
+//Returns the error from the last synchronous call made on the calling thread, or NULL if it succeeded
+//The string must be released with PowerPulse_FreeString
+//export PowerPulse_GetLastError
+func PowerPulse_GetLastError() *C.char {
+	return C.pp_dup_last_error()
+}
+
+//export PowerPulse_FreeString
+func PowerPulse_FreeString(str *C.char) {
+	C.free(unsafe.Pointer(str))
+}
@@ -43,6 +43,21 @@ func GetPaths_CPUFreq_Speed(prefix ...string) (string, string) {
 	return pathLoop(Paths_CPUFreq_Speed, prefix...)
 }
 
+var Paths_CPUFreq_InfoMax = []string{"cpuinfo_max_freq"}
+func GetPaths_CPUFreq_InfoMax(prefix ...string) (string, string) {
+	return pathLoop(Paths_CPUFreq_InfoMax, prefix...)
+}
+
+var Paths_CPUFreq_InfoMin = []string{"cpuinfo_min_freq"}
+func GetPaths_CPUFreq_InfoMin(prefix ...string) (string, string) {
+	return pathLoop(Paths_CPUFreq_InfoMin, prefix...)
+}
+
+var Paths_CPUFreq_Frequencies = []string{"scaling_available_frequencies"}
+func GetPaths_CPUFreq_Frequencies(prefix ...string) (string, string) {
+	return pathLoop(Paths_CPUFreq_Frequencies, prefix...)
+}
+
 var Paths_CPUFreq_Stats = []string{"stats"}
 func GetPaths_CPUFreq_Stats(prefix ...string) (string, string) {
 	return pathLoop(Paths_CPUFreq_Stats, prefix...)
@@ -73,6 +88,11 @@ func GetPaths_Cpusets_CPUExclusive(prefix ...string) (string, string) {
 	return pathLoop(Paths_Cpusets_CPUExclusive, prefix...)
 }
 
+var Paths_Cpusets_Tasks = []string{"cgroup.procs", "tasks"} //Processes before threads, as only the main thread has to be read
+func GetPaths_Cpusets_Tasks(prefix ...string) (string, string) {
+	return pathLoop(Paths_Cpusets_Tasks, prefix...)
+}
+
 var Paths_IPA = []string{"/sys/power/ipa"}
 func GetPaths_IPA(prefix ...string) (string, string) {
 	return pathLoop(Paths_IPA, prefix...)
@@ -103,6 +123,11 @@ func GetPaths_GPU_DVFS_Min(prefix ...string) (string, string) {
 	return pathLoop(Paths_GPU_DVFS_Min, prefix...)
 }
 
+var Paths_GPU_DVFS_Table = []string{"dvfs_table", "available_frequencies"}
+func GetPaths_GPU_DVFS_Table(prefix ...string) (string, string) {
+	return pathLoop(Paths_GPU_DVFS_Table, prefix...)
+}
+
 var Paths_GPU_Highspeed_Clock = []string{"highspeed_clock"}
 func GetPaths_GPU_Highspeed_Clock(prefix ...string) (string, string) {
 	return pathLoop(Paths_GPU_Highspeed_Clock, prefix...)
@@ -211,4 +236,14 @@ func GetPaths_Input(prefix ...string) (string, string) {
 var Paths_Input_Enabled = []string{"enabled"}
 func GetPaths_Input_Enabled(prefix ...string) (string, string) {
 	return pathLoop(Paths_Input_Enabled, prefix...)
-}
\ No newline at end of file
+}
+
+var Paths_PowerSupply = []string{"/sys/class/power_supply"}
+func GetPaths_PowerSupply(prefix ...string) (string, string) {
+	return pathLoop(Paths_PowerSupply, prefix...)
+}
+
+var Paths_Thermal = []string{"/sys/class/thermal"}
+func GetPaths_Thermal(prefix ...string) (string, string) {
+	return pathLoop(Paths_Thermal, prefix...)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const THROTTLE_INTERVAL_DEFAULT = 2000 //Milliseconds between temperature checks
+
+//Clusters ("clusters/<name>") and GPU ("gpu") capped by the last applied throttle steps, protected by lock
+//Kept across reloads, as the caps stay written until something writes the maximum back
+var throttleCapped = make(map[string]bool)
+
+//Caps maximum frequencies in steps as Sensor heats up, on top of whichever profile is applied
+type Throttle struct {
+	Name string
+	Sensor string //Usually a thermal zone, such as "thermal.battery"
+	Hysteresis json.Number //Degrees below a step's threshold to cool down to before releasing it
+	Steps []*ThrottleStep
+	hysteresis float64
+	step int //Index of the active step, or -1
+}
+
+//Each step replaces the caps of the steps below it
+type ThrottleStep struct {
+	Above json.Number //Threshold the sensor has to reach for this step to apply
+	Clusters map[string]Frequency //Maximum frequency per cluster, such as "80%" or "level:-2"
+	GPU Frequency //Maximum GPU DVFS frequency
+	above float64
+}
+
+func (dev *Device) initThrottle() error {
+	if dev.ThrottleInterval.String() != "" {
+		if interval, err := dev.ThrottleInterval.Int64(); err != nil || interval <= 0 {
+			return fmt.Errorf("throttle_interval: invalid interval %s", dev.ThrottleInterval)
+		}
+	}
+	names := make(map[string]bool)
+	for i, throttle := range dev.Throttle {
+		if throttle == nil {
+			return fmt.Errorf("throttle/%d: missing throttle", i)
+		}
+		if throttle.Name == "" {
+			throttle.Name = throttle.Sensor
+		}
+		if names[throttle.Name] {
+			return fmt.Errorf("throttle/%s: duplicate throttle name", throttle.Name)
+		}
+		names[throttle.Name] = true
+		throttle.step = -1
+
+		throttle.Sensor = strings.ToLower(throttle.Sensor)
+		if err := dev.validSensor(throttle.Sensor); err != nil {
+			return fmt.Errorf("throttle/%s: %v", throttle.Name, err)
+		}
+		if throttle.Hysteresis.String() != "" {
+			hysteresis, err := throttle.Hysteresis.Float64()
+			if err != nil || hysteresis < 0 {
+				return fmt.Errorf("throttle/%s: invalid hysteresis %s", throttle.Name, throttle.Hysteresis)
+			}
+			throttle.hysteresis = hysteresis
+		}
+		if len(throttle.Steps) == 0 {
+			return fmt.Errorf("throttle/%s: missing steps", throttle.Name)
+		}
+		for j, step := range throttle.Steps {
+			if step == nil {
+				return fmt.Errorf("throttle/%s/steps/%d: missing step", throttle.Name, j)
+			}
+			above, err := step.Above.Float64()
+			if err != nil {
+				return fmt.Errorf("throttle/%s/steps/%d: invalid threshold %s", throttle.Name, j, step.Above)
+			}
+			step.above = above
+			for clusterName := range step.Clusters {
+				if _, exists := dev.Paths.Clusters[clusterName]; !exists {
+					return fmt.Errorf("throttle/%s/steps/%d: unknown cluster %s", throttle.Name, j, clusterName)
+				}
+			}
+			if step.GPU != "" && (dev.Paths.GPU == nil || dev.Paths.GPU.DVFS == nil) {
+				return fmt.Errorf("throttle/%s/steps/%d: no gpu/dvfs paths to cap", throttle.Name, j)
+			}
+		}
+		sort.SliceStable(throttle.Steps, func(a, b int) bool { return throttle.Steps[a].above < throttle.Steps[b].above })
+		Debug("Found throttle %s on %s with %d steps", throttle.Name, throttle.Sensor, len(throttle.Steps))
+	}
+	return nil
+}
+
+//Returns the step for value, only stepping down once value falls hysteresis below the active step's threshold
+func (throttle *Throttle) nextStep(value float64) int {
+	target := -1
+	for i, step := range throttle.Steps {
+		if value >= step.above {
+			target = i
+		}
+	}
+	current := throttle.step
+	for current > target && value < throttle.Steps[current].above - throttle.hysteresis {
+		current--
+	}
+	if current > target {
+		return current
+	}
+	return target
+}
+
+//Checks the throttles until PowerPulse exits, picking up reloaded manifests as it goes
+func runThrottle() {
+	for {
+		interval := int64(THROTTLE_INTERVAL_DEFAULT)
+		if dev := currentDevice(); dev != nil {
+			if dev.ThrottleInterval.String() != "" {
+				interval, _ = dev.ThrottleInterval.Int64()
+			}
+			if len(dev.Throttle) > 0 {
+				evaluateThrottle(dev)
+			}
+		}
+		time.Sleep(time.Millisecond * time.Duration(interval))
+	}
+}
+
+func evaluateThrottle(dev *Device) {
+	lock.Lock()
+	defer lock.Unlock()
+	if dev != device {
+		return //Reloaded since the tick started, the next one checks the new throttles
+	}
+
+	changed := make([]string, 0)
+	readings := make(sensorReadings)
+	for _, throttle := range dev.Throttle {
+		value, err := dev.readSensor(throttle.Sensor, readings)
+		if err != nil {
+			Debug("Throttle %s: %v", throttle.Name, err)
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			Debug("Throttle %s: sensor %s is not numeric: %s", throttle.Name, throttle.Sensor, value)
+			continue
+		}
+		step := throttle.nextStep(number)
+		if step == throttle.step {
+			continue
+		}
+		throttle.step = step
+		detail := fmt.Sprintf("%s released at %s", throttle.Name, value)
+		if step >= 0 {
+			detail = fmt.Sprintf("%s step %d at %s", throttle.Name, step + 1, value)
+		}
+		Info("Throttle %s", detail)
+		changed = append(changed, detail)
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for _, detail := range changed {
+		publish(Event{Type: EventThrottle, Source: "thermal", Profile: profileNow, Detail: detail})
+	}
+	applyOverlays("thermal")
+}
+
+//Returns the active step of each throttle, counting from 1
+func (dev *Device) throttleSteps() map[string]int {
+	steps := make(map[string]int)
+	for _, throttle := range dev.Throttle {
+		if throttle.step >= 0 {
+			steps[throttle.Name] = throttle.step + 1
+		}
+	}
+	return steps
+}
+
+//Lowers the maximum frequencies of profile to the strictest active throttle step
+//Returns whether anything was capped, and what the active steps cap to store in throttleCapped once profile is applied
+func (dev *Device) applyThrottle(profile *Profile) (bool, map[string]bool, error) {
+	capped := false
+	active := make(map[string]bool)
+	for _, throttle := range dev.Throttle {
+		if throttle.step < 0 {
+			continue
+		}
+		step := throttle.Steps[throttle.step]
+		for clusterName, limit := range step.Clusters {
+			active["clusters/" + clusterName] = true
+			freq := profileCPUFreq(profile, clusterName)
+			domain := dev.cpuFreqDomain(clusterName)
+			capFreq, err := limit.Resolve(domain)
+			if err != nil {
+				return false, nil, fmt.Errorf("throttle/%s: cluster %s: %v", throttle.Name, clusterName, err)
+			}
+			for _, value := range []*Frequency{&freq.Max, &freq.Min, &freq.Speed} {
+				if c, err := capFrequency(value, capFreq, domain, value == &freq.Max); err != nil {
+					return false, nil, fmt.Errorf("throttle/%s: cluster %s: %v", throttle.Name, clusterName, err)
+				} else if c {
+					capped = true
+				}
+			}
+		}
+		if step.GPU != "" {
+			active["gpu"] = true
+			dvfs := profileDVFS(profile)
+			domain := dev.gpuFreqDomain()
+			capFreq, err := step.GPU.Resolve(domain)
+			if err != nil {
+				return false, nil, fmt.Errorf("throttle/%s: gpu: %v", throttle.Name, err)
+			}
+			for _, value := range []*Frequency{&dvfs.Max, &dvfs.Min} {
+				if c, err := capFrequency(value, capFreq, domain, value == &dvfs.Max); err != nil {
+					return false, nil, fmt.Errorf("throttle/%s: gpu: %v", throttle.Name, err)
+				} else if c {
+					capped = true
+				}
+			}
+		}
+	}
+
+	//Released caps stay written unless the profile sets its own maximum, so put back the highest frequency
+	for key := range throttleCapped {
+		if active[key] {
+			continue
+		}
+		if key == "gpu" {
+			if dev.Paths.GPU == nil || dev.Paths.GPU.DVFS == nil {
+				continue
+			}
+			if dvfs := profileDVFS(profile); dvfs.Max == "" {
+				Debug("Releasing throttle cap on gpu")
+				dvfs.Max = "max"
+			}
+		} else if clusterName := strings.TrimPrefix(key, "clusters/"); dev.Paths.Clusters[clusterName].CPUFreq != nil {
+			if freq := profileCPUFreq(profile, clusterName); freq.Max == "" {
+				Debug("Releasing throttle cap on cluster %s", clusterName)
+				freq.Max = "max"
+			}
+		}
+	}
+	return capped, active, nil
+}
+
+//Returns the cpufreq settings of the cluster in profile, adding them if they're missing
+func profileCPUFreq(profile *Profile, clusterName string) *CPUFreq {
+	if profile.Clusters == nil {
+		profile.Clusters = make(map[string]*Cluster)
+	}
+	cluster := profile.Clusters[clusterName]
+	if cluster == nil {
+		cluster = &Cluster{}
+		profile.Clusters[clusterName] = cluster
+	}
+	if cluster.CPUFreq == nil {
+		cluster.CPUFreq = &CPUFreq{}
+	}
+	return cluster.CPUFreq
+}
+
+//Returns the GPU DVFS settings in profile, adding them if they're missing
+func profileDVFS(profile *Profile) *DVFS {
+	if profile.GPU == nil {
+		profile.GPU = &GPU{}
+	}
+	if profile.GPU.DVFS == nil {
+		profile.GPU.DVFS = &DVFS{}
+	}
+	return profile.GPU.DVFS
+}
+
+//Lowers value to limit if it's above it, or sets it to limit when unset and required is true
+func capFrequency(value *Frequency, limit string, domain *FrequencyDomain, required bool) (bool, error) {
+	if *value == "" {
+		if !required {
+			return false, nil
+		}
+		*value = Frequency(limit)
+		return true, nil
+	}
+	resolved, err := value.Resolve(domain)
+	if err != nil {
+		return false, err
+	}
+	current, err := strconv.ParseInt(resolved, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	max, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	if current <= max {
+		return false, nil
+	}
+	*value = Frequency(limit)
+	return true, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+//Describes the write that broke a transaction, and whether the device made it back to where it started
+type TransactionError struct {
+	Path           string
+	Data           string
+	Err            error
+	RolledBack     int      //Paths restored to their snapshot
+	RollbackFailed []string //Paths that could not be restored
+}
+
+func (err *TransactionError) Error() string {
+	msg := fmt.Sprintf("failed writing '%s' > %s: %v", err.Data, err.Path, err.Err)
+	if len(err.RollbackFailed) > 0 {
+		return fmt.Sprintf("%s, rolled back %d paths but failed to restore %s", msg, err.RolledBack, err.RollbackFailed)
+	}
+	return fmt.Sprintf("%s, rolled back %d paths", msg, err.RolledBack)
+}
+
+func (err *TransactionError) Unwrap() error {
+	return err.Err
+}
+
+//Starts snapshotting every path that gets synced, so a failed profile can be undone as a whole
+//Returns false if a transaction was already running, in which case the caller doesn't own it
+func (dev *Device) beginTransaction() bool {
+	if dev.Journal != nil {
+		return false
+	}
+	dev.Journal = make([]BufferedWrite, 0)
+	return true
+}
+
+func (dev *Device) commitTransaction() {
+	dev.Journal = nil
+}
+
+//Remembers the value at path before its first write in the transaction
+func (dev *Device) journal(path string) {
+	if dev.Journal == nil {
+		return
+	}
+	for i := 0; i < len(dev.Journal); i++ {
+		if dev.Journal[i].Path == path {
+			return
+		}
+	}
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		//Nothing to restore for paths we can't read, most likely the write will fail too
+		Debug("Not snapshotting %s: %v", path, err)
+		return
+	}
+	if len(buffer) > 0 && buffer[len(buffer)-1] == '\n' { buffer = buffer[:len(buffer)-1] }
+	data := string(buffer)
+	if data == "" {
+		data = "-" //Restore by clearing the path
+	}
+	dev.Journal = append(dev.Journal, BufferedWrite{Path: path, Data: data})
+}
+
+//Restores every snapshot in reverse order and ends the transaction
+func (dev *Device) rollbackTransaction(txErr *TransactionError) {
+	journal := dev.Journal
+	dev.Journal = nil
+	if len(journal) > 0 {
+		Warn("Rolling back %d paths after %v", len(journal), txErr.Err)
+	}
+	for i := len(journal) - 1; i >= 0; i-- {
+		bw := journal[i]
+		if err := dev.write(bw.Path, bw.Data); err != nil {
+			txErr.RollbackFailed = append(txErr.RollbackFailed, bw.Path)
+			continue
+		}
+		txErr.RolledBack++
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncProfileRollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string //Starting values, a path missing here is a directory that can't be written
+		buffered   []BufferedWrite
+		rolledBack int
+	}{
+		{
+			name:       "earlier writes are restored",
+			files:      map[string]string{"a": "1", "b": "2"},
+			buffered:   []BufferedWrite{{"a", "10"}, {"b", "20"}, {"broken", "30"}},
+			rolledBack: 2,
+		},
+		{
+			name:       "empty paths are cleared again",
+			files:      map[string]string{"a": ""},
+			buffered:   []BufferedWrite{{"a", "10"}, {"broken", "30"}},
+			rolledBack: 1,
+		},
+		{
+			name:       "unchanged paths are restored as they were",
+			files:      map[string]string{"a": "1", "b": "2"},
+			buffered:   []BufferedWrite{{"a", "1"}, {"b", "20"}, {"broken", "30"}},
+			rolledBack: 2,
+		},
+		{
+			name:       "nothing written before the failure",
+			files:      map[string]string{"a": "1"},
+			buffered:   []BufferedWrite{{"broken", "30"}, {"a", "10"}},
+			rolledBack: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Mkdir(filepath.Join(dir, "broken"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			dev := &Device{}
+			for _, write := range test.buffered {
+				dev.BufferWrite(filepath.Join(dir, write.Path), write.Data)
+			}
+			err := dev.SyncProfile()
+			txErr := &TransactionError{}
+			if !errors.As(err, &txErr) {
+				t.Fatalf("got %v, want a transaction error", err)
+			}
+			if txErr.Path != filepath.Join(dir, "broken") {
+				t.Errorf("got failed path %s, want %s", txErr.Path, filepath.Join(dir, "broken"))
+			}
+			if txErr.RolledBack != test.rolledBack || len(txErr.RollbackFailed) > 0 {
+				t.Errorf("got %d paths rolled back and %v failed, want %d rolled back", txErr.RolledBack, txErr.RollbackFailed, test.rolledBack)
+			}
+			for name, want := range test.files {
+				if got, _ := readValue(filepath.Join(dir, name)); got != want {
+					t.Errorf("%s: got %q, want %q", name, got, want)
+				}
+			}
+			if dev.Journal != nil {
+				t.Errorf("transaction is still running")
+			}
+		})
+	}
+}
+
+//Transactions begun by the caller span several syncs and are only rolled back by the caller, to the first snapshot of each path
+func TestTransactionAcrossSyncs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a")
+	if err := ioutil.WriteFile(path, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "broken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dev := &Device{ProfileApplied: &Profile{}}
+	if !dev.beginTransaction() {
+		t.Fatal("failed to begin transaction")
+	}
+	if dev.beginTransaction() {
+		t.Error("began a transaction inside another one")
+	}
+	dev.BufferWrite(path, "10")
+	if err := dev.SyncProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dev.BufferWrite(path, "20")
+	dev.BufferWrite(filepath.Join(dir, "broken"), "30")
+	err := dev.SyncProfile()
+	txErr := &TransactionError{}
+	if !errors.As(err, &txErr) {
+		t.Fatalf("got %v, want a transaction error", err)
+	}
+	if got, _ := readValue(path); got != "20" {
+		t.Errorf("got %q before the caller rolled back, want %q", got, "20")
+	}
+
+	dev.rollbackTransaction(txErr)
+	if got, _ := readValue(path); got != "1" {
+		t.Errorf("got %q, want %q", got, "1")
+	}
+	if txErr.RolledBack != 1 {
+		t.Errorf("got %d paths rolled back, want 1", txErr.RolledBack)
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const validateUsage = `usage: powerpulse validate [manifest]
+
+Checks the manifest, or the first one found in the usual places, and prints every problem with its location
+`
+
+type manifestProblem struct {
+	Line int
+	Path string
+	Msg  string
+}
+
+//Walks the manifest token by token against the Device type, so every problem can be reported with its location
+type manifestValidator struct {
+	file     string
+	data     []byte
+	decoder  *json.Decoder
+	lines    map[string]int //Line of each key, by lineKey
+	problems []manifestProblem
+}
+
+var (
+	typeProfile   = reflect.TypeOf(Profile{})
+	typeFrequency = reflect.TypeOf(Frequency(""))
+	typeNumber    = reflect.TypeOf(json.Number(""))
+)
+
+//Validates a manifest and returns the exit code
+func validate(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprint(os.Stderr, validateUsage)
+		return 2
+	}
+	file := ""
+	if len(args) == 1 {
+		switch args[0] {
+		case "help", "-h", "--help":
+			fmt.Print(validateUsage)
+			return 0
+		}
+		file = args[0]
+	} else {
+		for i := 0; i < len(manifests); i++ {
+			if _, err := os.Stat(manifests[i]); err == nil {
+				file = manifests[i]
+				break
+			}
+		}
+		if file == "" {
+			fmt.Fprintf(os.Stderr, "powerpulse: no manifest was found in %s\n", manifests)
+			return 1
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "powerpulse: %v\n", err)
+		return 1
+	}
+
+	v := &manifestValidator{file: file, data: data, lines: make(map[string]int)}
+	v.validate()
+	sort.SliceStable(v.problems, func(i, j int) bool { return v.problems[i].Line < v.problems[j].Line })
+	for _, problem := range v.problems {
+		if problem.Path == "" {
+			fmt.Printf("%s:%d: %s\n", file, problem.Line, problem.Msg)
+		} else {
+			fmt.Printf("%s:%d: %s: %s\n", file, problem.Line, problem.Path, problem.Msg)
+		}
+	}
+	if len(v.problems) == 1 {
+		fmt.Printf("%s: 1 problem\n", file)
+		return 1
+	} else if len(v.problems) > 1 {
+		fmt.Printf("%s: %d problems\n", file, len(v.problems))
+		return 1
+	}
+	fmt.Printf("%s: ok\n", file)
+	return 0
+}
+
+func (v *manifestValidator) validate() {
+	//Problems are printed with their location instead, and loading logs the same ones without it
+	quiet = true
+	defer func() { quiet = false }()
+
+	//Everything after the strict decode works on what's left once the problems it found are dropped
+	cleaned, ok := v.decode()
+	if !ok {
+		return
+	}
+	dev, err := parseManifest(cleaned)
+	if err != nil {
+		v.reportError("", err)
+		return
+	}
+	names := make([]string, 0, len(dev.Profiles))
+	for name := range dev.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if dev.Profiles[name] != nil {
+			v.checkProfile(dev, dev.Profiles[name], "profiles/" + name, true)
+		}
+	}
+
+	//Load the rest the way the daemon would, but check every section instead of stopping at the first problem
+	for _, section := range manifestSections {
+		if err := section.init(dev); err != nil {
+			v.reportError("", err)
+		}
+	}
+	requested := dev.bootProfile(profileNow)
+	dev.defaultInheritance(requested)
+	if err := dev.initExtends(); err != nil {
+		//Profiles can't be resolved through broken inheritance
+		v.reportError("", err)
+		return
+	}
+	dev.resolveProfiles()
+	if err := dev.initOrder(requested); err != nil {
+		v.reportError("", err)
+	} else if err := dev.initLineage(); err != nil {
+		v.reportError("", err)
+	}
+	v.resolveProfiles(dev)
+}
+
+//Decodes strictly, reporting unknown keys and values of the wrong type, and returns the manifest without them
+//Returns false on broken JSON
+func (v *manifestValidator) decode() ([]byte, bool) {
+	v.decoder = json.NewDecoder(bytes.NewReader(v.data))
+	v.decoder.UseNumber()
+	value, _, err := v.walk(reflect.TypeOf(Device{}), "", false)
+	if err != nil {
+		v.reportAt(v.decoder.InputOffset(), "", "invalid JSON: %v", err)
+		return nil, false
+	}
+	if _, err := v.decoder.Token(); err == nil {
+		v.reportAt(v.decoder.InputOffset(), "", "unexpected data after the manifest")
+	}
+	if value == nil {
+		value = make(map[string]interface{})
+	}
+	cleaned, err := json.Marshal(value)
+	if err != nil {
+		v.report("", "%v", err)
+		return nil, false
+	}
+	return cleaned, true
+}
+
+//Reads a value of type t, returning it and whether it should be kept
+func (v *manifestValidator) walk(t reflect.Type, path string, inProfile bool) (interface{}, bool, error) {
+	tok, err := v.decoder.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	return v.walkToken(t, path, inProfile, tok)
+}
+
+func (v *manifestValidator) walkToken(t reflect.Type, path string, inProfile bool, tok json.Token) (interface{}, bool, error) {
+	//Any setting in a profile can be unset to drop it from the parents
+	if tok == nil || (inProfile && isUnset(tok)) {
+		return tok, true, nil
+	}
+	switch t {
+	case typeFrequency:
+		switch tok.(type) {
+		case string, json.Number:
+			raw, _ := json.Marshal(tok)
+			freq := Frequency("")
+			if err := freq.UnmarshalJSON(raw); err != nil {
+				v.report(path, "%v", err)
+				return nil, false, nil
+			}
+			return tok, true, nil
+		}
+		return v.mismatch(path, "a frequency", tok)
+	case typeNumber:
+		switch value := tok.(type) {
+		case json.Number:
+			return tok, true, nil
+		case string:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				v.report(path, "expected a number, got %q", value)
+				return nil, false, nil
+			}
+			return tok, true, nil
+		}
+		return v.mismatch(path, "a number", tok)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return v.walkToken(t.Elem(), path, inProfile, tok)
+
+	case reflect.Struct:
+		if tok != json.Delim('{') {
+			return v.mismatch(path, "an object", tok)
+		}
+		if t == typeProfile {
+			inProfile = true
+		}
+		obj := make(map[string]interface{})
+		for v.decoder.More() {
+			key, err := v.key(path)
+			if err != nil {
+				return nil, false, err
+			}
+			field, found := jsonField(t, key)
+			if !found {
+				v.report(pathJoinJSON(path, key), "unknown key")
+				if err := v.skip(); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+			value, keep, err := v.walk(field.Type, pathJoinJSON(path, key), inProfile)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				obj[key] = value
+			}
+		}
+		_, err := v.decoder.Token()
+		return obj, true, err
+
+	case reflect.Map:
+		if tok != json.Delim('{') {
+			return v.mismatch(path, "an object", tok)
+		}
+		obj := make(map[string]interface{})
+		for v.decoder.More() {
+			key, err := v.key(path)
+			if err != nil {
+				return nil, false, err
+			}
+			value, keep, err := v.walk(t.Elem(), pathJoinJSON(path, key), inProfile)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				obj[key] = value
+			}
+		}
+		_, err := v.decoder.Token()
+		return obj, true, err
+
+	case reflect.Slice:
+		if tok != json.Delim('[') {
+			return v.mismatch(path, "an array", tok)
+		}
+		list := make([]interface{}, 0)
+		for i := 0; v.decoder.More(); i++ {
+			itemPath := pathJoinJSON(path, strconv.Itoa(i))
+			v.lines[lineKey(itemPath)] = v.line(v.decoder.InputOffset())
+			value, keep, err := v.walk(t.Elem(), itemPath, inProfile)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				list = append(list, value)
+			}
+		}
+		_, err := v.decoder.Token()
+		return list, true, err
+
+	case reflect.String:
+		if _, isString := tok.(string); !isString {
+			return v.mismatch(path, "a string", tok)
+		}
+	case reflect.Bool:
+		if _, isBool := tok.(bool); !isBool {
+			return v.mismatch(path, "a bool", tok)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, isNumber := tok.(json.Number); !isNumber {
+			return v.mismatch(path, "a number", tok)
+		}
+	case reflect.Interface:
+		//Only governor tunables are free-form, and they're written as bools, numbers or strings
+		switch tok.(type) {
+		case bool, json.Number, string:
+			return tok, true, nil
+		}
+		return v.mismatch(path, "a bool, number or string", tok)
+	}
+	return tok, true, nil
+}
+
+//Reads an object key and records its line
+func (v *manifestValidator) key(path string) (string, error) {
+	tok, err := v.decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	key := tok.(string)
+	v.lines[lineKey(pathJoinJSON(path, key))] = v.line(v.decoder.InputOffset())
+	return key, nil
+}
+
+//Reports a value of the wrong type and skips the rest of it, so it's dropped
+func (v *manifestValidator) mismatch(path, expected string, tok json.Token) (interface{}, bool, error) {
+	got := "null"
+	switch tok.(type) {
+	case json.Delim:
+		if tok == json.Delim('{') {
+			got = "an object"
+		} else {
+			got = "an array"
+		}
+	case bool:
+		got = "a bool"
+	case json.Number:
+		got = "a number"
+	case string:
+		got = "a string"
+	}
+	v.report(path, "expected %s, got %s", expected, got)
+	return nil, false, v.skipRest(tok)
+}
+
+func (v *manifestValidator) skip() error {
+	tok, err := v.decoder.Token()
+	if err != nil {
+		return err
+	}
+	return v.skipRest(tok)
+}
+
+//Skips the rest of a value whose first token was already read
+func (v *manifestValidator) skipRest(tok json.Token) error {
+	if tok != json.Delim('{') && tok != json.Delim('[') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := v.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+//Finds the field encoding/json would decode key into
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		if name == key {
+			return field, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = &field
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+//Matches paths however they were spelled, the way profile names are matched
+func lineKey(path string) string {
+	return strings.ReplaceAll(strings.ToLower(path), " ", "_")
+}
+
+func pathJoinJSON(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "/" + key
+}
+
+func (v *manifestValidator) line(offset int64) int {
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	return bytes.Count(v.data[:offset], []byte("\n")) + 1
+}
+
+func (v *manifestValidator) reportAt(offset int64, path, format string, args ...interface{}) {
+	v.problems = append(v.problems, manifestProblem{Line: v.line(offset), Path: lineKey(path), Msg: fmt.Sprintf(format, args...)})
+}
+
+//Reports an error under path, moving down to the setting it leads with, such as "clusters/apollo/cpufreq/max: ..."
+func (v *manifestValidator) reportError(path string, err error) {
+	msg := err.Error()
+	if split := strings.Index(msg, ": "); split > 0 && !strings.Contains(msg[:split], " ") && strings.Contains(msg[:split], "/") {
+		path = pathJoinJSON(path, msg[:split])
+		msg = msg[split+2:]
+	}
+	v.report(path, "%s", msg)
+}
+
+//Reports a problem at the line of path, or of the closest parent that was found in the manifest
+func (v *manifestValidator) report(path, format string, args ...interface{}) {
+	line := 1
+	for search := lineKey(path); search != ""; {
+		if found, exists := v.lines[search]; exists {
+			line = found
+			break
+		}
+		parent := strings.LastIndex(search, "/")
+		if parent < 0 {
+			break
+		}
+		search = search[:parent]
+	}
+	//Paths are printed the way the daemon spells them, whatever the manifest used
+	v.problems = append(v.problems, manifestProblem{Line: line, Path: lineKey(path), Msg: fmt.Sprintf(format, args...)})
+}
+
+//Checks every cluster, cpuset, governor and subsystem the profile refers to against the discovered paths
+//Returns false if applying the profile can't be planned
+func (v *manifestValidator) checkProfile(dev *Device, profile *Profile, path string, report bool) bool {
+	ok := true
+	problem := func(subpath, format string, args ...interface{}) {
+		ok = false
+		if report {
+			v.report(pathJoinJSON(path, subpath), format, args...)
+		}
+	}
+
+	for clusterName, cluster := range profile.Clusters {
+		clusterPath := "clusters/" + clusterName
+		pathCluster, exists := dev.Paths.Clusters[clusterName]
+		if !exists {
+			problem(clusterPath, "unknown cluster, expected one of %s", sortedKeys(dev.Paths.Clusters))
+			continue
+		}
+		if cluster == nil || cluster.CPUFreq == nil {
+			continue
+		}
+		if pathCluster.CPUFreq == nil {
+			problem(clusterPath + "/cpufreq", "no cpufreq paths for cluster %s", clusterName)
+			continue
+		}
+		freq := cluster.CPUFreq
+		if freq.Governor == "" && len(freq.Governors) == 0 {
+			continue
+		}
+		governorsPath := pathJoin(pathCluster.Path, pathCluster.CPUFreq.Path, pathCluster.CPUFreq.Governors)
+		available, err := readValue(governorsPath)
+		if err != nil {
+			problem(clusterPath + "/cpufreq", "failed to read available governors: %v", err)
+			continue
+		}
+		governors := strings.Fields(available)
+		if freq.Governor != "" {
+			governor := freq.Governor
+			if governor == "powerpulse" {
+				governor = "userspace" //Our own governor drives userspace
+			}
+			if !containsString(governors, governor) {
+				problem(clusterPath + "/cpufreq/governor", "governor %s is not available, expected one of %s", governor, governors)
+			}
+		}
+		for governorName := range freq.Governors {
+			if !containsString(governors, governorName) {
+				problem(clusterPath + "/cpufreq/governors/" + governorName, "governor is not available, expected one of %s", governors)
+			}
+		}
+	}
+
+	for cpusetName := range profile.CPUSets {
+		if dev.Paths.Cpusets == nil {
+			problem("cpusets/" + cpusetName, "no cpuset paths")
+			continue
+		}
+		if _, exists := dev.Paths.Cpusets.Sets[cpusetName]; !exists {
+			problem("cpusets/" + cpusetName, "unknown cpuset, expected one of %s", sortedKeys(dev.Paths.Cpusets.Sets))
+		}
+	}
+
+	if profile.GPU != nil {
+		if dev.Paths.GPU == nil {
+			problem("gpu", "no gpu paths")
+		} else {
+			if profile.GPU.DVFS != nil && dev.Paths.GPU.DVFS == nil {
+				problem("gpu/dvfs", "no gpu/dvfs paths")
+			}
+			if profile.GPU.Highspeed != nil && dev.Paths.GPU.Highspeed == nil {
+				problem("gpu/highspeed", "no gpu/highspeed paths")
+			}
+		}
+	}
+	if profile.Kernel != nil && dev.Paths.Kernel == nil {
+		problem("kernel", "no kernel paths")
+	}
+	if profile.IPA != nil && dev.Paths.IPA == nil {
+		problem("ipa", "no ipa paths")
+	}
+	if profile.InputBooster != nil && dev.Paths.InputBooster == nil {
+		problem("inputbooster", "no inputbooster paths")
+	}
+	if profile.SecSlow != nil && dev.Paths.SecSlow == nil {
+		problem("secslow", "no secslow paths")
+	}
+	return ok
+}
+
+//Plans every resolved profile, which catches settings that only break once inherited, such as frequencies out of range
+func (v *manifestValidator) resolveProfiles(dev *Device) {
+	dev.DryRun = true
+	names := make([]string, 0, len(dev.ProfilesResolved))
+	for name := range dev.ProfilesResolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := dev.GetProfile(name)
+		//Anything broken in the profile itself was already reported where it was set
+		if !v.checkProfile(dev, profile, "profiles/" + name, false) {
+			continue
+		}
+		if err := dev.setProfile(profile, name); err != nil {
+			v.reportError("profiles/" + name, err)
+		}
+		dev.Buffered = make([]BufferedWrite, 0)
+		dev.BufferedPairs = nil
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	VIRTUAL_WEIGHTED = "weighted" //Sum of each input times its weight
+	VIRTUAL_MAX      = "max"
+	VIRTUAL_MIN      = "min"
+
+	VIRTUAL_SAMPLE_SPACING = time.Second //Reads closer together than this reuse the last sample
+)
+
+//A sensor computed from other sensors, such as a skin temperature estimated from several thermal zones
+type VirtualSensor struct {
+	Type string //weighted, max or min
+	Inputs []*SensorInput
+	Offset json.Number //Added to the combined value
+	Average json.Number //Number of samples to average over, smoothing out spikes
+	Predict json.Number //Seconds to extrapolate the trend over the averaged samples, to react before it gets hot
+	offset float64
+	average int
+	predict float64
+	samples []sensorSample
+	last string //Value from the last read, for status to report without adding a sample
+	mutex sync.Mutex
+}
+
+type SensorInput struct {
+	Sensor string
+	Weight json.Number //Only used by weighted sensors, defaults to 1
+	weight float64
+}
+
+type sensorSample struct {
+	Time time.Time
+	Value float64
+}
+
+func (dev *Device) initSensors() error {
+	sensors := make(map[string]*VirtualSensor)
+	for key, sensor := range dev.Sensors {
+		name := strings.ToLower(key)
+		if name == SENSOR_CHARGING || strings.Contains(name, ".") {
+			return fmt.Errorf("sensors/%s: virtual sensor names can't contain dots or be %s", key, SENSOR_CHARGING)
+		}
+		if sensor == nil {
+			return fmt.Errorf("sensors/%s: missing sensor", key)
+		}
+
+		sensor.Type = strings.ToLower(sensor.Type)
+		switch sensor.Type {
+		case VIRTUAL_WEIGHTED, VIRTUAL_MAX, VIRTUAL_MIN:
+		default:
+			return fmt.Errorf("sensors/%s: unknown type %s", key, sensor.Type)
+		}
+		if len(sensor.Inputs) == 0 {
+			return fmt.Errorf("sensors/%s: missing inputs", key)
+		}
+		for i, input := range sensor.Inputs {
+			if input == nil {
+				return fmt.Errorf("sensors/%s/inputs/%d: missing input", key, i)
+			}
+			input.Sensor = strings.ToLower(input.Sensor)
+			if !strings.Contains(input.Sensor, ".") && input.Sensor != SENSOR_CHARGING {
+				return fmt.Errorf("sensors/%s/inputs/%d: inputs must be real sensors, not %s", key, i, input.Sensor)
+			}
+			if err := dev.validSensor(input.Sensor); err != nil {
+				return fmt.Errorf("sensors/%s/inputs/%d: %v", key, i, err)
+			}
+			input.weight = 1
+			if input.Weight.String() != "" {
+				weight, err := input.Weight.Float64()
+				if err != nil {
+					return fmt.Errorf("sensors/%s/inputs/%d: invalid weight %s", key, i, input.Weight)
+				}
+				input.weight = weight
+			}
+		}
+
+		if sensor.Offset.String() != "" {
+			offset, err := sensor.Offset.Float64()
+			if err != nil {
+				return fmt.Errorf("sensors/%s: invalid offset %s", key, sensor.Offset)
+			}
+			sensor.offset = offset
+		}
+		sensor.average = 1
+		if sensor.Average.String() != "" {
+			average, err := sensor.Average.Int64()
+			if err != nil || average < 1 {
+				return fmt.Errorf("sensors/%s: invalid average %s", key, sensor.Average)
+			}
+			sensor.average = int(average)
+		}
+		if sensor.Predict.String() != "" {
+			predict, err := sensor.Predict.Float64()
+			if err != nil || predict < 0 {
+				return fmt.Errorf("sensors/%s: invalid prediction %s", key, sensor.Predict)
+			}
+			sensor.predict = predict
+			if sensor.average < 2 {
+				sensor.average = 2 //A trend needs at least two samples
+			}
+		}
+		sensors[name] = sensor
+		Debug("Found virtual sensor %s: %s of %d inputs", name, sensor.Type, len(sensor.Inputs))
+	}
+	dev.Sensors = sensors
+
+	units := make(map[string]string)
+	for zone, unit := range dev.ThermalUnits {
+		unit = strings.ToLower(unit)
+		if _, exists := thermalUnits[unit]; !exists {
+			return fmt.Errorf("thermal_units/%s: unknown unit %s, expected one of %s", zone, unit, sortedKeys(thermalUnits))
+		}
+		units[strings.ToLower(zone)] = unit
+	}
+	dev.ThermalUnits = units
+	return nil
+}
+
+func (dev *Device) readVirtual(sensor *VirtualSensor, readings sensorReadings) (string, error) {
+	sensor.mutex.Lock()
+	defer sensor.mutex.Unlock()
+
+	now := time.Now()
+	if len(sensor.samples) == 0 || now.Sub(sensor.samples[len(sensor.samples)-1].Time) >= VIRTUAL_SAMPLE_SPACING {
+		value, err := dev.combineInputs(sensor, readings)
+		if err != nil {
+			return "", err
+		}
+		sensor.samples = append(sensor.samples, sensorSample{Time: now, Value: value})
+		if len(sensor.samples) > sensor.average {
+			sensor.samples = sensor.samples[len(sensor.samples)-sensor.average:]
+		}
+	}
+
+	sum := 0.0
+	for _, sample := range sensor.samples {
+		sum += sample.Value
+	}
+	value := sum / float64(len(sensor.samples))
+
+	if sensor.predict > 0 && len(sensor.samples) >= 2 {
+		first, last := sensor.samples[0], sensor.samples[len(sensor.samples)-1]
+		if elapsed := last.Time.Sub(first.Time).Seconds(); elapsed > 0 {
+			value += (last.Value - first.Value) / elapsed * sensor.predict
+		}
+	}
+
+	value += sensor.offset
+	sensor.last = strconv.FormatFloat(math.Round(value * 1000) / 1000, 'f', -1, 64)
+	return sensor.last, nil
+}
+
+//Returns the value from the last read, if there was one
+func (sensor *VirtualSensor) lastValue() (string, bool) {
+	sensor.mutex.Lock()
+	defer sensor.mutex.Unlock()
+	return sensor.last, sensor.last != ""
+}
+
+func (dev *Device) combineInputs(sensor *VirtualSensor, readings sensorReadings) (float64, error) {
+	combined := 0.0
+	for i, input := range sensor.Inputs {
+		raw, err := dev.readSensor(input.Sensor, readings)
+		if err != nil {
+			return 0, err
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, fmt.Errorf("sensor %s is not numeric: %s", input.Sensor, raw)
+		}
+		switch {
+		case sensor.Type == VIRTUAL_WEIGHTED:
+			combined += value * input.weight
+		case i == 0:
+			combined = value
+		case sensor.Type == VIRTUAL_MAX:
+			combined = math.Max(combined, value)
+		case sensor.Type == VIRTUAL_MIN:
+			combined = math.Min(combined, value)
+		}
+	}
+	return combined, nil
+}
+
+//Reads every sensor the manifest refers to, for the status command
+//Virtual sensors report their last value, as reading them would add samples and change what rules and throttles see
+func (dev *Device) readAllSensors() map[string]string {
+	names := make(map[string]bool)
+	for name, sensor := range dev.Sensors {
+		names[name] = true
+		for _, input := range sensor.Inputs {
+			names[input.Sensor] = true
+		}
+	}
+	for _, rule := range dev.Rules {
+		for _, cond := range rule.conditions {
+			names[cond.Sensor] = true
+		}
+	}
+	for _, throttle := range dev.Throttle {
+		names[throttle.Sensor] = true
+	}
+	if dev.ProfileBootSettle != nil {
+		names[dev.ProfileBootSettle.Sensor] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	values := make(map[string]string)
+	readings := make(sensorReadings)
+	for _, name := range sorted {
+		if sensor, exists := dev.Sensors[name]; exists {
+			value, sampled := sensor.lastValue()
+			if !sampled {
+				value = "(not read yet)"
+			}
+			values[name] = value
+			continue
+		}
+		value, err := dev.readSensor(name, readings)
+		if err != nil {
+			value = "(" + err.Error() + ")"
+		}
+		values[name] = value
+	}
+	return values
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+//Edge-triggered nodes that have to be written every time, even with the same value
+var defaultWriteCacheExclude = []string{"boostpulse"}
+
+type cachedWrite struct {
+	Written  string //The value we last wrote
+	ReadBack string //The value read back after writing it, which the kernel may have normalized
+}
+
+func (dev *Device) initWriteCache() error {
+	dev.WriteCache = make(map[string]cachedWrite)
+	for _, pattern := range dev.WriteCacheExclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("write_cache_exclude: invalid pattern %s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+//Patterns match either the full path or just its base name
+func (dev *Device) writeCacheExcluded(path string) bool {
+	base := filepath.Base(path)
+	for _, patterns := range [][]string{defaultWriteCacheExclude, dev.WriteCacheExclude} {
+		for _, pattern := range patterns {
+			if match, _ := filepath.Match(pattern, base); match {
+				return true
+			}
+			if match, _ := filepath.Match(pattern, path); match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func readValue(path string) (string, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if len(buffer) > 0 && buffer[len(buffer)-1] == '\n' { buffer = buffer[:len(buffer)-1] }
+	return string(buffer), nil
+}
+
+//Returns true if path already holds data, either verbatim or as the kernel normalized our last identical write
+func (dev *Device) writeUnchanged(path, data string) bool {
+	if dev.writeCacheExcluded(path) {
+		return false
+	}
+	current, err := readValue(path)
+	if err != nil {
+		return false //Write-only or missing, let the write decide
+	}
+
+	dev.WriteCacheMutex.Lock()
+	defer dev.WriteCacheMutex.Unlock()
+	if dev.WriteCache == nil {
+		dev.WriteCache = make(map[string]cachedWrite)
+	}
+	if cached, exists := dev.WriteCache[path]; exists {
+		if cached.ReadBack != current {
+			//Something else wrote here since we did
+			Debug("External change to %s: %s -> %s", path, cached.ReadBack, current)
+			delete(dev.WriteCache, path)
+		} else if cached.Written == data {
+			return true
+		}
+	}
+	return current == data
+}
+
+//Remembers what path reads back as after writing data to it
+func (dev *Device) writeCached(path, data string) {
+	if dev.writeCacheExcluded(path) {
+		return
+	}
+	readBack, err := readValue(path)
+
+	dev.WriteCacheMutex.Lock()
+	defer dev.WriteCacheMutex.Unlock()
+	if dev.WriteCache == nil {
+		dev.WriteCache = make(map[string]cachedWrite)
+	}
+	if err != nil {
+		delete(dev.WriteCache, path)
+		return
+	}
+	dev.WriteCache[path] = cachedWrite{Written: data, ReadBack: readBack}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteCacheExcluded(t *testing.T) {
+	dev := &Device{WriteCacheExclude: []string{"io_is_*", "/sys/devices/*/cpufreq/scaling_governor"}}
+	if err := dev.initWriteCache(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/sys/devices/system/cpu/cpufreq/interactive/boostpulse", true},
+		{"/sys/devices/system/cpu/cpufreq/interactive/io_is_busy", true},
+		{"/sys/devices/cpu0/cpufreq/scaling_governor", true},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := dev.writeCacheExcluded(test.path); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+
+	if err := (&Device{WriteCacheExclude: []string{"["}}).initWriteCache(); err == nil {
+		t.Error("invalid pattern was accepted")
+	}
+}
+
+func TestWriteUnchanged(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string //Base name of the path
+		current   *string //Value on disk, or nil if it's missing
+		cached    *cachedWrite
+		data      string
+		want      bool
+		keepCache bool
+	}{
+		{name: "same value", file: "max", current: stringRef("1600000"), data: "1600000", want: true},
+		{name: "different value", file: "max", current: stringRef("1600000"), data: "800000", want: false},
+		{name: "missing path", file: "max", current: nil, data: "800000", want: false},
+		{name: "excluded path", file: "boostpulse", current: stringRef("1"), data: "1", want: false},
+		{
+			name: "normalized by the kernel", file: "governor", current: stringRef("1 2"),
+			cached: &cachedWrite{Written: "1-2", ReadBack: "1 2"}, data: "1-2", want: true, keepCache: true,
+		},
+		{
+			name: "normalized, writing something else", file: "governor", current: stringRef("1 2"),
+			cached: &cachedWrite{Written: "1-2", ReadBack: "1 2"}, data: "3-4", want: false, keepCache: true,
+		},
+		{
+			name: "changed by someone else", file: "governor", current: stringRef("5 6"),
+			cached: &cachedWrite{Written: "1-2", ReadBack: "1 2"}, data: "1-2", want: false, keepCache: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if test.current != nil {
+				if err := ioutil.WriteFile(path, []byte(*test.current + "\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dev := &Device{WriteCache: make(map[string]cachedWrite)}
+			if test.cached != nil {
+				dev.WriteCache[path] = *test.cached
+			}
+			if got := dev.writeUnchanged(path, test.data); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+			if _, cached := dev.WriteCache[path]; test.cached != nil && cached != test.keepCache {
+				t.Errorf("got cached %t, want %t", cached, test.keepCache)
+			}
+		})
+	}
+}
+
+//Writes remember what the path reads back as, and excluded paths are never cached
+func TestWriteCaches(t *testing.T) {
+	dir := t.TempDir()
+	dev := &Device{}
+	if err := dev.initWriteCache(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"max", "boostpulse"} {
+		if err := dev.write(filepath.Join(dir, name), "1"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if got := dev.WriteCache[filepath.Join(dir, "max")]; got != (cachedWrite{Written: "1", ReadBack: "1"}) {
+		t.Errorf("max: got %+v cached", got)
+	}
+	if got, cached := dev.WriteCache[filepath.Join(dir, "boostpulse")]; cached {
+		t.Errorf("boostpulse: got %+v cached, want it excluded", got)
+	}
+}
+
+func stringRef(value string) *string {
+	return &value
+}